@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"ledctl3/event"
+	"ledctl3/internal/api"
+	"ledctl3/internal/device"
+	"ledctl3/internal/device/debug_output"
+	screensrc "ledctl3/internal/device/screen"
+	"ledctl3/internal/registry"
+	"ledctl3/pkg/memserver"
+	"ledctl3/pkg/uuid"
+)
+
+// registryAddr is the address of the registry on the in-process network.
+const registryAddr = "registry"
+
+// Config describes the registry and every device that runs alongside it.
+type Config struct {
+	// State is the path of the file the registry state is kept in.
+	State   string         `json:"state"`
+	Devices []DeviceConfig `json:"devices"`
+	// HTTPPort is the port the management API is served on, which is used
+	// to create and enable profiles. Zero disables it. HTTPHost is the
+	// address it listens on, localhost by default, and APIToken is the
+	// bearer token every request must present.
+	HTTPPort int    `json:"http_port"`
+	HTTPHost string `json:"http_host"`
+	APIToken string `json:"api_token"`
+}
+
+type DeviceConfig struct {
+	Id uuid.UUID `json:"id"`
+	// Screen adds the displays of the machine as inputs of the device.
+	Screen  bool           `json:"screen"`
+	Outputs []OutputConfig `json:"outputs"`
+}
+
+type OutputConfig struct {
+	Id   uuid.UUID `json:"id"`
+	Leds int       `json:"leds"`
+}
+
+type sh struct {
+	path string
+}
+
+func (s sh) SetState(state registry.State) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.path, b, 0644)
+}
+
+func (s sh) GetState() (registry.State, error) {
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return registry.State{}, err
+	}
+
+	var state registry.State
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return registry.State{}, err
+	}
+
+	return state, nil
+}
+
+func readConfig() (Config, error) {
+	cfg := Config{
+		State:    "../registry.json",
+		HTTPHost: "127.0.0.1",
+	}
+
+	b, err := os.ReadFile("../ledctl.json")
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// startDevice runs a device with its own server on the network and connects
+// it to the registry.
+func startDevice(network *memserver.Network[event.Event], cfg DeviceConfig) error {
+	s := network.New(cfg.Id.String())
+
+	dev, err := device.New(
+		device.Config{
+			Id: cfg.Id,
+		},
+		s)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Screen {
+		screenProv, err := screensrc.New(dev)
+		if err != nil {
+			return err
+		}
+
+		screenProv.Start()
+	}
+
+	for _, out := range cfg.Outputs {
+		dev.AddOutput(debug_output.New(out.Id, out.Leds))
+	}
+
+	conn, err := s.Connect(registryAddr)
+	if err != nil {
+		return err
+	}
+
+	go s.ProcessEvents(registryAddr, conn)
+
+	fmt.Println(cfg.Id, "started")
+
+	return nil
+}
+
+func main() {
+	cfg, err := readConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	network := memserver.NewNetwork[event.Event]()
+
+	s := network.New(registryAddr)
+
+	reg := registry.New(sh{path: cfg.State}, s)
+
+	if cfg.HTTPPort != 0 {
+		if cfg.APIToken == "" {
+			panic("api_token is required to serve the management api")
+		}
+
+		addr := net.JoinHostPort(cfg.HTTPHost, strconv.Itoa(cfg.HTTPPort))
+
+		go func() {
+			err := http.ListenAndServe(addr, api.New(reg, cfg.APIToken))
+			if err != nil {
+				fmt.Println("error serving api:", err)
+			}
+		}()
+	}
+
+	err = s.Start()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("registry started")
+
+	for _, dev := range cfg.Devices {
+		err = startDevice(network, dev)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	select {}
+}
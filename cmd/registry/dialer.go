@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"ledctl3/pkg/connector"
+	"ledctl3/pkg/uuid"
+)
+
+// dialer keeps outbound connections to devices that accept connections, so
+// that they are handled just like devices that connect to the registry.
+// Connections are keyed by device id, so that a device that is both listed
+// statically and discovered is only dialed once.
+type dialer struct {
+	mux        sync.Mutex
+	connect    func(addr net.Addr) error
+	connectors map[string]*dialed
+	// keys maps every dialed address to the key of its connector.
+	keys map[string]string
+}
+
+type dialed struct {
+	c      *connector.Connector
+	cancel context.CancelFunc
+	addrs  []net.Addr
+}
+
+func newDialer(connect func(addr net.Addr) error) *dialer {
+	return &dialer{
+		connect:    connect,
+		connectors: make(map[string]*dialed),
+		keys:       make(map[string]string),
+	}
+}
+
+// Dial keeps a connection to the device identified by key, reconnecting
+// with backoff whenever it is lost. Addresses dialed for the same key are
+// tried in turn. Devices whose id is not known yet are keyed by address
+// until Identify resolves them.
+func (d *dialer) Dial(key string, addr net.Addr) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	// the address was dialed before under another key, e.g. a static
+	// address that turns out to be a discovered device
+	if k, ok := d.keys[addr.String()]; ok && k != key {
+		d.rekey(k, key, false)
+	}
+
+	dl, ok := d.connectors[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		dl = &dialed{
+			c:      connector.New(d.connect),
+			cancel: cancel,
+		}
+		d.connectors[key] = dl
+
+		go func() {
+			_ = dl.c.Run(ctx)
+		}()
+	}
+
+	d.add(key, dl, addr)
+}
+
+// Identify records the id of the device connected at addr. If the address
+// was dialed under another key, its connector is keyed by the device id
+// from then on, and takes over the addresses of any other connector of the
+// device.
+func (d *dialer) Identify(addr string, id uuid.UUID) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	k, ok := d.keys[addr]
+	if !ok || k == id.String() {
+		// an inbound connection, or one dialed by id already
+		return
+	}
+
+	d.rekey(k, id.String(), true)
+}
+
+// rekey moves the connector of from to the key to. If there already is a
+// connector for to, one of them is stopped and its addresses are handed to
+// the other: the connector of from if keepFrom is set, the one of to
+// otherwise.
+func (d *dialer) rekey(from, to string, keepFrom bool) {
+	src := d.connectors[from]
+	delete(d.connectors, from)
+
+	dst, ok := d.connectors[to]
+	if !ok {
+		d.connectors[to] = src
+		for _, a := range src.addrs {
+			d.keys[a.String()] = to
+		}
+
+		return
+	}
+
+	keep, drop := dst, src
+	if keepFrom {
+		keep, drop = src, dst
+	}
+
+	drop.cancel()
+	d.connectors[to] = keep
+
+	for _, a := range keep.addrs {
+		d.keys[a.String()] = to
+	}
+
+	for _, a := range drop.addrs {
+		d.add(to, keep, a)
+	}
+}
+
+func (d *dialer) add(key string, dl *dialed, addr net.Addr) {
+	d.keys[addr.String()] = key
+
+	for _, a := range dl.addrs {
+		if a.String() == addr.String() {
+			return
+		}
+	}
+
+	dl.addrs = append(dl.addrs, addr)
+	dl.c.AddAddr(addr)
+}
@@ -1,17 +1,76 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"ledctl3/event"
+	"ledctl3/internal/api"
 	"ledctl3/internal/registry"
+	"ledctl3/pkg/codec"
+	"ledctl3/pkg/dataplane"
+	"ledctl3/pkg/discovery"
+	"ledctl3/pkg/eventlog"
 	"ledctl3/pkg/mdns"
 	"ledctl3/pkg/netserver"
+	"ledctl3/pkg/transport"
+	"ledctl3/pkg/wsserver"
 )
 
+const (
+	heartbeatInterval = 1 * time.Second
+	readTimeout       = 5 * time.Second
+	// queueStatsInterval is how often connections that fall behind and
+	// drop realtime data are reported.
+	queueStatsInterval = 10 * time.Second
+	// browseInterval is how often the devices advertised on the network
+	// are browsed anew, well within registry.DefaultDiscoveredTTL.
+	browseInterval = 1 * time.Minute
+)
+
+type Config struct {
+	Transport string `json:"transport"`
+	Port      int    `json:"port"`
+	// DataPort is the UDP port of the realtime data plane. Zero disables it.
+	DataPort int `json:"data_port"`
+	// TLSCert and TLSKey are the paths of the PEM encoded certificate and
+	// key used to encrypt device links. TLS is disabled if they are empty.
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	// Pairing requires devices to be adopted before they can exchange data.
+	Pairing bool `json:"pairing"`
+	// ProbePort is the UDP port broadcast discovery probes are answered on.
+	// Zero disables the responder.
+	ProbePort int `json:"probe_port"`
+	// DeviceAddrs lists the addresses of devices the registry connects to,
+	// in addition to the listening devices it discovers.
+	DeviceAddrs []string `json:"device_addrs"`
+	// TLSCA is the path of a PEM encoded certificate the certificates of
+	// devices the registry connects to are verified against.
+	TLSCA string `json:"tls_ca"`
+	// EventLogDir is the directory every event passing through the registry
+	// is recorded to, in a log file named after the time the registry was
+	// started, including the data sent over the data plane. Recording is
+	// disabled if it is empty.
+	EventLogDir string `json:"event_log_dir"`
+	// HTTPPort is the port the management API is served on. Zero disables
+	// it. HTTPHost is the address it listens on, localhost by default, and
+	// APIToken is the bearer token every request must present.
+	HTTPPort int    `json:"http_port"`
+	HTTPHost string `json:"http_host"`
+	APIToken string `json:"api_token"`
+}
+
 type sh struct {
 }
 
@@ -39,35 +98,203 @@ func (s sh) GetState() (registry.State, error) {
 	return state, nil
 }
 
+func readConfig() (Config, error) {
+	cfg := Config{
+		Transport: "tcp",
+		Port:      1337,
+		ProbePort: discovery.DefaultProbePort,
+		HTTPHost:  "127.0.0.1",
+	}
+
+	b, err := os.ReadFile("../registry.config.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return Config{}, err
+	}
+
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// browseDevices records the devices that advertise themselves on the
+// network, so that devices that fail to connect can still be seen, and
+// connects to those that accept connections. Browsing is restarted every
+// browseInterval, as devices are only reported when they are first seen.
+func browseDevices(reg *registry.Registry, d *dialer) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), browseInterval)
+		browse(ctx, reg, d)
+		<-ctx.Done()
+		cancel()
+	}
+}
+
+func browse(ctx context.Context, reg *registry.Registry, d *dialer) {
+	resolver := mdns.NewResolver()
+
+	devs, err := resolver.Browse(ctx)
+	if err != nil {
+		fmt.Println("error browsing devices:", err)
+		return
+	}
+
+	for dev := range devs {
+		reg.DeviceDiscovered(registry.DiscoveredDevice{
+			Id:      dev.Id,
+			Name:    dev.Name,
+			Addr:    dev.Addr.String(),
+			Inputs:  dev.Inputs,
+			Outputs: dev.Outputs,
+		})
+
+		if dev.Listening {
+			d.Dial(dev.Id.String(), dev.Addr)
+		}
+	}
+}
+
 func main() {
-	s := netserver.New[event.Event](1337, event.Codec)
+	cfg, err := readConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	var s transport.Transport[event.Event]
+	var codecs []codec.Codec[event.Event]
+	switch cfg.Transport {
+	case "tcp":
+		// gob for Go devices, msgpack and json for embedded and scripting
+		// clients; each connection announces the codec it speaks
+		codecs = []codec.Codec[event.Event]{event.Codec, event.MsgpackCodec, event.JSONCodec}
+
+		ns := netserver.New[event.Event](cfg.Port, codecs...)
+		ns.SetHeartbeatInterval(heartbeatInterval)
+		ns.SetReadTimeout(readTimeout)
+		ns.SetWritePolicy(netserver.WritePolicy[event.Event]{
+			Droppable: event.Droppable,
+			Replaces:  event.Replaces,
+		})
+
+		go ns.ReportQueueStats(context.Background(), queueStatsInterval)
+
+		if cfg.TLSCert != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+			if err != nil {
+				panic(err)
+			}
+
+			tlsCfg := &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+			}
+
+			if cfg.TLSCA != "" {
+				b, err := os.ReadFile(cfg.TLSCA)
+				if err != nil {
+					panic(err)
+				}
+
+				tlsCfg.RootCAs = x509.NewCertPool()
+				if !tlsCfg.RootCAs.AppendCertsFromPEM(b) {
+					panic("invalid tls ca")
+				}
+			}
+
+			ns.SetTLSConfig(tlsCfg)
+		}
+
+		s = ns
+	case "ws":
+		if cfg.TLSCert != "" {
+			panic("tls is only supported by the tcp transport")
+		}
+
+		codecs = []codec.Codec[event.Event]{event.JSONCodec, event.MsgpackCodec}
+
+		s = wsserver.New[event.Event](cfg.Port, codecs...)
+	default:
+		panic(fmt.Sprintf("unknown transport %q", cfg.Transport))
+	}
+
+	var rec *eventlog.Recorder[event.Event]
+	if cfg.EventLogDir != "" {
+		name := time.Now().Format("20060102-150405") + ".evlog"
+
+		w, err := eventlog.Create[event.Event](filepath.Join(cfg.EventLogDir, name))
+		if err != nil {
+			panic(err)
+		}
+
+		rec = eventlog.Record(s, w)
+		s = rec
+	}
 
 	sh := sh{}
-	reg := registry.New(sh, func(addr string, e event.Event) error {
-		return s.Write(addr, e)
-	})
+	reg := registry.New(sh, s)
 
-	s.SetMessageHandler(func(addr string, e event.Event) {
-		reg.ProcessEvent(addr, e)
-	})
+	reg.SetPairingRequired(cfg.Pairing)
 
-	s.SetConnectHandler(func(addr string) {
-		//fmt.Println("device connected")
-	})
+	names := make([]string, 0, len(codecs))
+	for _, c := range codecs {
+		names = append(names, c.Name())
+	}
 
-	s.SetDisconnectHandler(func(addr string) {
-		reg.ProcessEvent(addr, event.Disconnect{})
-	})
+	reg.SetCodecs(names...)
+
+	if cfg.HTTPPort != 0 {
+		if cfg.APIToken == "" {
+			panic("api_token is required to serve the management api")
+		}
+
+		addr := net.JoinHostPort(cfg.HTTPHost, strconv.Itoa(cfg.HTTPPort))
+
+		go func() {
+			err := http.ListenAndServe(addr, api.New(reg, cfg.APIToken))
+			if err != nil {
+				fmt.Println("error serving api:", err)
+			}
+		}()
+	}
+
+	if cfg.DataPort != 0 {
+		dp := dataplane.New[event.Event](cfg.DataPort, event.Codec)
+
+		handler := func(addr string, e event.Event) {
+			err := reg.ProcessData(addr, e)
+			if err != nil {
+				fmt.Println("error processing data:", err)
+			}
+		}
+
+		write := dp.Write
+		if rec != nil {
+			handler, write = rec.RecordData(handler, write)
+		}
+
+		dp.SetMessageHandler(handler)
+
+		err = dp.Start()
+		if err != nil {
+			panic(err)
+		}
+
+		reg.SetDataPlane(dp.Port(), write)
+	}
 
 	time.Sleep(1 * time.Second)
 	fmt.Println("registry started")
 
-	err := s.Start()
+	err = s.Start()
 	if err != nil {
 		panic(err)
 	}
 
-	mdnsServer, err := mdns.NewServer("registry", 1337)
+	mdnsServer, err := mdns.NewServer("registry", cfg.Port, "v="+event.ProtocolVersion)
 	if err != nil {
 		panic(err)
 	}
@@ -77,57 +304,31 @@ func main() {
 		panic(err)
 	}
 
-	//go func() {
-	//	time.Sleep(10 * time.Second)
-	//
-	//	fmt.Println("Activating profile!")
-	//	err = reg.EnableProfile(uuid.MustParse("ffffffff-2e2d-4470-b9ab-c78786bf5667"))
-	//	if err != nil {
-	//		panic(err)
-	//	}
-	//}()
-
-	//go func() {
-	//	time.Sleep(5 * time.Second)
-	//	_, err = reg.CreateProfile("custom", []registry.ProfileSource{
-	//		{
-	//			Id: uuid.MustParse("55555555-dca5-430b-971c-fbe5b9112bfe"),
-	//			Inputs: []registry.ProfileInput{
-	//				{
-	//					Id: uuid.MustParse("22222222-b301-47d6-b289-2a4c3327962a"),
-	//					Sinks: []registry.ProfileSink{
-	//						{
-	//							Id: uuid.MustParse("55555555-dca5-430b-971c-fbe5b9112bfe"),
-	//							Outputs: []registry.ProfileOutput{
-	//								{
-	//									Id:            uuid.MustParse("88888888-6b50-4789-b635-16237d268efa"),
-	//									InputConfigId: uuid.Nil,
-	//								},
-	//							},
-	//						},
-	//					},
-	//				},
-	//				{
-	//					Id: uuid.MustParse("33333333-e72d-470e-a343-5c2cc2f1746f"),
-	//					Sinks: []registry.ProfileSink{
-	//						{
-	//							Id: uuid.MustParse("55555555-dca5-430b-971c-fbe5b9112bfe"),
-	//							Outputs: []registry.ProfileOutput{
-	//								{
-	//									Id:            uuid.MustParse("88888888-6b50-4789-b635-16237d268efa"),
-	//									InputConfigId: uuid.Nil,
-	//								},
-	//							},
-	//						},
-	//					},
-	//				},
-	//			},
-	//		},
-	//	})
-	//	if err != nil {
-	//		fmt.Println("error adding profile:", err)
-	//	}
-	//}()
+	d := newDialer(func(addr net.Addr) error {
+		return s.Dial(addr.String())
+	})
+
+	for _, a := range cfg.DeviceAddrs {
+		addr, err := net.ResolveTCPAddr("tcp", a)
+		if err != nil {
+			panic(err)
+		}
+
+		d.Dial(a, addr)
+	}
+
+	reg.SetConnectHandler(d.Identify)
+
+	go browseDevices(reg, d)
+
+	if cfg.ProbePort != 0 {
+		responder := discovery.NewResponder(cfg.ProbePort, cfg.Port)
+
+		err = responder.Start()
+		if err != nil {
+			panic(err)
+		}
+	}
 
 	select {}
 }
@@ -0,0 +1,9 @@
+package event
+
+import "ledctl3/pkg/uuid"
+
+// Ack is sent by a device once it has successfully applied the request with
+// the given id.
+type Ack struct {
+	RequestId uuid.UUID
+}
@@ -2,6 +2,9 @@ package event
 
 import "ledctl3/pkg/uuid"
 
+// AssistedSetup asks a device to propose a config for one of its inputs. The
+// device replies with AssistedSetupConfig and an Ack.
 type AssistedSetup struct {
-	InputId uuid.UUID
+	RequestId uuid.UUID
+	InputId   uuid.UUID
 }
@@ -2,8 +2,10 @@ package event
 
 import "ledctl3/pkg/uuid"
 
+// AssistedSetupConfig carries the config a device proposes for an input in
+// reply to AssistedSetup.
 type AssistedSetupConfig struct {
-	SourceId uuid.UUID
-	InputId  uuid.UUID
-	Config   any
+	RequestId uuid.UUID
+	InputId   uuid.UUID
+	Config    map[string]any
 }
@@ -6,28 +6,43 @@ import (
 	"ledctl3/pkg/codec"
 )
 
-var Codec codec.Codec[Event]
+var (
+	Codec        codec.Codec[Event]
+	JSONCodec    codec.Codec[Event]
+	MsgpackCodec codec.Codec[Event]
+)
 
-func init() {
-	Codec = codec.NewGobCodec[Event](
-		[]any{},
-		map[string]any{},
-		AssistedSetup{},
-		AssistedSetupConfig{},
-		Capabilities{},
-		Connect{},
-		Data{},
-		ListCapabilities{},
-		SetInputConfig{},
-		SetSinkActive{},
-		SetSourceActive{},
-		SetInputActive{},
-		SetSourceIdle{},
-		InputConnected{},
-		InputDisconnected{},
-		OutputConnected{},
-		OutputDisconnected{},
-		color.NRGBA{},
-	)
+// types lists every type that can be carried by an event over the wire.
+var types = []any{
+	[]any{},
+	map[string]any{},
+	Ack{},
+	AssistedSetup{},
+	AssistedSetupConfig{},
+	Capabilities{},
+	Connect{},
+	ConnectAck{},
+	Data{},
+	DataChannel{},
+	Error{},
+	ListCapabilities{},
+	Paired{},
+	SetInputConfig{},
+	InputConfigApplied{},
+	SetSinkActive{},
+	SetSinkIdle{},
+	SetSourceActive{},
+	SetInputActive{},
+	SetSourceIdle{},
+	InputConnected{},
+	InputDisconnected{},
+	OutputConnected{},
+	OutputDisconnected{},
+	color.NRGBA{},
+}
 
+func init() {
+	Codec = codec.NewGobCodec[Event](types...)
+	JSONCodec = codec.NewJSONCodec[Event](types...)
+	MsgpackCodec = codec.NewMsgpackCodec[Event](types...)
 }
@@ -3,5 +3,14 @@ package event
 import "ledctl3/pkg/uuid"
 
 type Connect struct {
-	Id uuid.UUID
+	Id       uuid.UUID
+	Version  string
+	Codecs   []string
+	Features []Feature
+	// DataPort is the UDP port the device receives realtime data on, if it
+	// announces FeatureUDPData.
+	DataPort int
+	// Token is the credential issued to the device when it was paired with
+	// the registry, if any.
+	Token string
 }
@@ -0,0 +1,11 @@
+package event
+
+// ConnectAck is the reply of the registry to the Connect of a device once
+// the device is accepted. It carries the protocol version of the registry
+// and the codecs and features both sides support, which are the only ones
+// used on the connection.
+type ConnectAck struct {
+	Version  string
+	Codecs   []string
+	Features []Feature
+}
@@ -1,8 +1,7 @@
 package event
 
 import (
-	"image/color"
-
+	"ledctl3/pkg/pixfmt"
 	"ledctl3/pkg/uuid"
 )
 
@@ -12,6 +11,6 @@ type Data struct {
 }
 
 type DataOutput struct {
-	Id  uuid.UUID
-	Pix []color.Color
+	Id uuid.UUID
+	pixfmt.Frame
 }
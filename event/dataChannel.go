@@ -0,0 +1,7 @@
+package event
+
+// DataChannel is sent by the registry once the UDP data plane has been
+// negotiated, and carries the port that realtime data should be sent to.
+type DataChannel struct {
+	Port int
+}
@@ -0,0 +1,25 @@
+package event
+
+import "ledctl3/pkg/uuid"
+
+type ErrorCode string
+
+const (
+	ErrorCodeIncompatibleVersion ErrorCode = "incompatible_version"
+	ErrorCodeIncompatibleCodec   ErrorCode = "incompatible_codec"
+	ErrorCodeInputNotFound       ErrorCode = "input_not_found"
+	ErrorCodeOutputNotFound      ErrorCode = "output_not_found"
+	ErrorCodeInputStartFailed    ErrorCode = "input_start_failed"
+	ErrorCodeInputStopFailed     ErrorCode = "input_stop_failed"
+	ErrorCodeInputConfigFailed   ErrorCode = "input_config_failed"
+	ErrorCodeUnauthorized        ErrorCode = "unauthorized"
+	ErrorCodeAlreadyConnected    ErrorCode = "already_connected"
+)
+
+// Error is sent in reply to a request that could not be applied. RequestId
+// is empty if the error is not related to a specific request.
+type Error struct {
+	RequestId uuid.UUID
+	Code      ErrorCode
+	Reason    string
+}
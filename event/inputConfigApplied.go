@@ -0,0 +1,11 @@
+package event
+
+import "ledctl3/pkg/uuid"
+
+// InputConfigApplied is sent by a device once it applied the config of a
+// SetInputConfig request to a running input. Config is the config in effect.
+type InputConfigApplied struct {
+	RequestId uuid.UUID
+	InputId   uuid.UUID
+	Config    map[string]any
+}
@@ -2,8 +2,11 @@ package event
 
 import "ledctl3/pkg/uuid"
 
+// InputConnected announces an input of a device. Outputs lists the outputs
+// the input is already feeding, e.g. after the device reconnected.
 type InputConnected struct {
-	Id     uuid.UUID
-	Schema map[string]any
-	Config map[string]any
+	Id      uuid.UUID
+	Schema  map[string]any
+	Config  map[string]any
+	Outputs []SetInputActiveOutput
 }
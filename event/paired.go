@@ -0,0 +1,7 @@
+package event
+
+// Paired is sent by the registry on first contact when pairing is required.
+// The device presents Token in every subsequent Connect.
+type Paired struct {
+	Token string
+}
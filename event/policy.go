@@ -0,0 +1,57 @@
+package event
+
+import "slices"
+
+// Droppable reports whether an event may be discarded when a peer cannot
+// keep up. Only realtime data is droppable; control events never are, and
+// neither are keyframes, as the deltas that follow them cannot be decoded
+// without them. Queued keyframes are superseded by newer ones instead, see
+// Replaces.
+func Droppable(e Event) bool {
+	data, ok := e.(Data)
+	if !ok {
+		return false
+	}
+
+	for _, out := range data.Outputs {
+		if out.Keyframe() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Replaces reports whether e supersedes the queued event q, i.e. both carry
+// frames for the same outputs and dropping q does not leave the receiver
+// without a keyframe that e depends on.
+func Replaces(q, e Event) bool {
+	old, ok := q.(Data)
+	if !ok {
+		return false
+	}
+
+	data, ok := e.(Data)
+	if !ok {
+		return false
+	}
+
+	if old.SinkId != data.SinkId || len(old.Outputs) != len(data.Outputs) {
+		return false
+	}
+
+	for _, out := range old.Outputs {
+		i := slices.IndexFunc(data.Outputs, func(o DataOutput) bool {
+			return o.Id == out.Id
+		})
+		if i == -1 {
+			return false
+		}
+
+		if out.Keyframe() && !data.Outputs[i].Keyframe() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -5,8 +5,9 @@ import (
 )
 
 type SetInputActive struct {
-	Id      uuid.UUID
-	Outputs []SetInputActiveOutput
+	RequestId uuid.UUID
+	Id        uuid.UUID
+	Outputs   []SetInputActiveOutput
 }
 
 type SetInputActiveOutput struct {
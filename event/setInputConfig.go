@@ -2,7 +2,10 @@ package event
 
 import "ledctl3/pkg/uuid"
 
+// SetInputConfig asks a device to change the config of an input without
+// restarting it. The device replies with InputConfigApplied and an Ack.
 type SetInputConfig struct {
-	InputId uuid.UUID
-	Config  any
+	RequestId uuid.UUID
+	InputId   uuid.UUID
+	Config    map[string]any
 }
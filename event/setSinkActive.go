@@ -5,6 +5,7 @@ import (
 )
 
 type SetSinkActive struct {
+	RequestId uuid.UUID
 	SessionId uuid.UUID
 	OutputIds []uuid.UUID
 }
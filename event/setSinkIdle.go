@@ -0,0 +1,12 @@
+package event
+
+import (
+	"ledctl3/pkg/uuid"
+)
+
+// SetSinkIdle tells a sink device that its outputs are no longer fed by any
+// input, so that it can blank them.
+type SetSinkIdle struct {
+	RequestId uuid.UUID
+	OutputIds []uuid.UUID
+}
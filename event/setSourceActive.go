@@ -5,7 +5,8 @@ import (
 )
 
 type SetSourceActive struct {
-	Inputs []SetSourceActiveInput
+	RequestId uuid.UUID
+	Inputs    []SetSourceActiveInput
 }
 
 type SetSourceActiveInput struct {
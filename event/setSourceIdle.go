@@ -5,7 +5,8 @@ import (
 )
 
 type SetSourceIdle struct {
-	Inputs []SetSourceIdleInput
+	RequestId uuid.UUID
+	Inputs    []SetSourceIdleInput
 }
 
 type SetSourceIdleInput struct {
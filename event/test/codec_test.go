@@ -0,0 +1,143 @@
+package event_test
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/pkg/pixfmt"
+	"ledctl3/pkg/uuid"
+)
+
+// events returns an instance of every event type, for round trip tests.
+func events() []event.Event {
+	return []event.Event{
+		event.Ack{RequestId: uuid.New()},
+		event.AssistedSetup{RequestId: uuid.New(), InputId: uuid.New()},
+		event.AssistedSetupConfig{
+			RequestId: uuid.New(),
+			InputId:   uuid.New(),
+			Config:    map[string]any{"width": float64(1920)},
+		},
+		event.Capabilities{
+			Inputs:  []event.CapabilitiesInput{{Id: uuid.New(), Type: event.InputTypeScreenCapture}},
+			Outputs: []event.CapabilitiesOutput{{Id: uuid.New(), Leds: 40}},
+		},
+		event.Connect{
+			Id:       uuid.New(),
+			Version:  event.ProtocolVersion,
+			Codecs:   []string{"msgpack"},
+			Features: []event.Feature{event.FeatureUDPData},
+			DataPort: 1338,
+			Token:    "token",
+		},
+		event.ConnectAck{
+			Version:  event.ProtocolVersion,
+			Codecs:   []string{"msgpack"},
+			Features: []event.Feature{event.FeatureUDPData},
+		},
+		event.Data{
+			SinkId: uuid.New(),
+			Outputs: []event.DataOutput{
+				{
+					Id: uuid.New(),
+					Frame: pixfmt.Frame{
+						Format: pixfmt.RGB,
+						Key:    1,
+						Pix:    []byte{255, 0, 0, 0, 128, 255},
+					},
+				},
+				{
+					Id: uuid.New(),
+					Frame: pixfmt.Frame{
+						Format: pixfmt.RGBW,
+						Key:    1,
+						Delta:  []pixfmt.Range{{Offset: 2, Pix: []byte{0, 0, 0, 255}}},
+					},
+				},
+			},
+		},
+		event.DataChannel{Port: 1338},
+		event.Error{RequestId: uuid.New(), Code: event.ErrorCodeInputNotFound, Reason: "input not found"},
+		event.ListCapabilities{},
+		event.Paired{Token: "token"},
+		event.SetInputConfig{InputId: uuid.New(), Config: map[string]any{"framerate": float64(30)}},
+		event.InputConfigApplied{RequestId: uuid.New(), InputId: uuid.New(), Config: map[string]any{"framerate": float64(30)}},
+		event.SetSinkActive{SessionId: uuid.New(), OutputIds: []uuid.UUID{uuid.New()}},
+		event.SetSourceActive{
+			Inputs: []event.SetSourceActiveInput{
+				{
+					Id:      uuid.New(),
+					Outputs: []event.SetSourceActiveOutput{{Id: uuid.New(), SinkId: uuid.New(), Leds: 40}},
+				},
+			},
+		},
+		event.SetInputActive{
+			Id: uuid.New(),
+			Outputs: []event.SetInputActiveOutput{
+				{Id: uuid.New(), SinkId: uuid.New(), Leds: 40, Config: map[string]any{"reverse": true}},
+			},
+		},
+		event.SetSourceIdle{
+			Inputs: []event.SetSourceIdleInput{{InputId: uuid.New(), OutputIds: []uuid.UUID{uuid.New()}}},
+		},
+		event.SetSinkIdle{OutputIds: []uuid.UUID{uuid.New()}},
+		event.InputConnected{Id: uuid.New(), Schema: map[string]any{"type": "object"}},
+		event.InputDisconnected{Id: uuid.New()},
+		event.OutputConnected{Id: uuid.New(), Leds: 80},
+		event.OutputDisconnected{Id: uuid.New()},
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	for _, e := range events() {
+		b, err := event.JSONCodec.MarshalEvent(e)
+		assert.NilError(t, err)
+
+		var got event.Event
+		err = event.JSONCodec.UnmarshalEvent(b, &got)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, e)
+	}
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	for _, e := range events() {
+		b, err := event.MsgpackCodec.MarshalEvent(e)
+		assert.NilError(t, err)
+
+		var got event.Event
+		err = event.MsgpackCodec.UnmarshalEvent(b, &got)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, e)
+	}
+
+	t.Run("unknown type", func(t *testing.T) {
+		// {"type": "Unknown"}
+		b := []byte{0x81, 0xa4, 't', 'y', 'p', 'e', 0xa7, 'U', 'n', 'k', 'n', 'o', 'w', 'n'}
+
+		var e event.Event
+		err := event.MsgpackCodec.UnmarshalEvent(b, &e)
+		assert.Error(t, err, `unknown event type "Unknown"`)
+	})
+}
+
+func TestJSONCodecEnvelope(t *testing.T) {
+	id := uuid.New()
+
+	b, err := event.JSONCodec.MarshalEvent(event.InputDisconnected{Id: id})
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"type":"InputDisconnected","data":{"Id":"`+id.String()+`"}}`)
+
+	t.Run("unknown type", func(t *testing.T) {
+		var e event.Event
+		err := event.JSONCodec.UnmarshalEvent([]byte(`{"type":"Unknown","data":{}}`), &e)
+		assert.Error(t, err, `unknown event type "Unknown"`)
+	})
+
+	t.Run("unregistered type", func(t *testing.T) {
+		_, err := event.JSONCodec.MarshalEvent(event.Disconnect{})
+		assert.Error(t, err, "unregistered event type event.Disconnect")
+	})
+}
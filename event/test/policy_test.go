@@ -0,0 +1,62 @@
+package event_test
+
+import (
+	"slices"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/pkg/pixfmt"
+	"ledctl3/pkg/uuid"
+)
+
+func TestWritePolicy(t *testing.T) {
+	sinkId := uuid.New()
+	outId := uuid.New()
+
+	keyframe := event.Data{
+		SinkId:  sinkId,
+		Outputs: []event.DataOutput{{Id: outId, Frame: pixfmt.Frame{Key: 1, Pix: []byte{1, 2, 3}}}},
+	}
+
+	delta := event.Data{
+		SinkId:  sinkId,
+		Outputs: []event.DataOutput{{Id: outId, Frame: pixfmt.Frame{Key: 1}}},
+	}
+
+	other := event.Data{
+		SinkId:  sinkId,
+		Outputs: []event.DataOutput{{Id: uuid.New(), Frame: pixfmt.Frame{Key: 1}}},
+	}
+
+	t.Run("only data is droppable", func(t *testing.T) {
+		assert.Assert(t, event.Droppable(delta))
+		assert.Assert(t, !event.Droppable(event.SetInputActive{}))
+	})
+
+	t.Run("keyframes are not droppable", func(t *testing.T) {
+		assert.Assert(t, !event.Droppable(keyframe))
+
+		mixed := event.Data{
+			SinkId:  sinkId,
+			Outputs: append(slices.Clone(other.Outputs), keyframe.Outputs...),
+		}
+		assert.Assert(t, !event.Droppable(mixed))
+	})
+
+	t.Run("newer frames replace older ones", func(t *testing.T) {
+		assert.Assert(t, event.Replaces(delta, delta))
+		assert.Assert(t, event.Replaces(delta, keyframe))
+		assert.Assert(t, event.Replaces(keyframe, keyframe))
+	})
+
+	t.Run("deltas do not replace keyframes", func(t *testing.T) {
+		assert.Assert(t, !event.Replaces(keyframe, delta))
+	})
+
+	t.Run("frames for other outputs are kept", func(t *testing.T) {
+		assert.Assert(t, !event.Replaces(delta, other))
+		assert.Assert(t, !event.Replaces(event.SetInputActive{}, delta))
+	})
+}
@@ -0,0 +1,90 @@
+package event
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version of the event protocol spoken by this build.
+// Minor and patch releases only add optional behaviour, which is negotiated
+// through features; a major release breaks compatibility.
+const ProtocolVersion = "0.1.0"
+
+// Feature is an optional protocol capability. A feature is only used on a
+// connection if both sides announce it during the Connect handshake.
+type Feature string
+
+const (
+	// FeatureUDPData moves Data events to a separate UDP channel, so that
+	// a stalled frame does not delay later frames or control events.
+	FeatureUDPData Feature = "udp_data"
+	// FeatureInputConfig lets the registry change the config of a running
+	// input with SetInputConfig.
+	FeatureInputConfig Feature = "input_config"
+	// FeatureAssistedSetup lets the registry ask a device to propose a
+	// config for an input with AssistedSetup.
+	FeatureAssistedSetup Feature = "assisted_setup"
+)
+
+// CompatibleVersion returns an error if a peer speaking the given protocol
+// version cannot talk to this build. An empty version is sent by peers that
+// predate version negotiation, and is accepted without any features.
+func CompatibleVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+
+	major, err := majorVersion(version)
+	if err != nil {
+		return err
+	}
+
+	ownMajor, err := majorVersion(ProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	if major != ownMajor {
+		return fmt.Errorf("incompatible protocol version %s, expected %d.x.x", version, ownMajor)
+	}
+
+	return nil
+}
+
+func majorVersion(version string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid protocol version %q", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol version %q", version)
+	}
+
+	return major, nil
+}
+
+// NegotiateFeatures returns the features that are supported by both sides.
+func NegotiateFeatures(local, remote []Feature) []Feature {
+	return negotiate(local, remote)
+}
+
+// NegotiateCodecs returns the codecs that are supported by both sides, in
+// the order of preference of the remote side.
+func NegotiateCodecs(local, remote []string) []string {
+	return negotiate(local, remote)
+}
+
+func negotiate[T comparable](local, remote []T) []T {
+	var common []T
+	for _, v := range remote {
+		if slices.Contains(local, v) && !slices.Contains(common, v) {
+			common = append(common, v)
+		}
+	}
+
+	return common
+}
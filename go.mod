@@ -7,6 +7,7 @@ require (
 	github.com/go-ole/go-ole v1.2.6
 	github.com/google/uuid v1.2.0
 	github.com/gookit/color v1.5.3
+	github.com/gorilla/websocket v1.5.0
 	github.com/grandcat/zeroconf v1.0.1-0.20230119201135-e4f60f8407b1
 	github.com/kirides/screencapture v0.0.0-20211031174040-89bc8578d816
 	github.com/lucasb-eyer/go-colorful v1.2.0
@@ -16,6 +17,7 @@ require (
 	github.com/samber/lo v1.38.1
 	github.com/sgreben/piecewiselinear v1.1.1
 	github.com/stretchr/testify v1.8.4
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/image v0.6.0
 	gonum.org/v1/gonum v0.13.0
@@ -28,6 +30,7 @@ require (
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/miekg/dns v1.1.55 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
 	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
 	github.com/xo/terminfo v0.0.0-20210125001918-ca9a967f8778 // indirect
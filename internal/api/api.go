@@ -0,0 +1,417 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ledctl3/internal/registry"
+	"ledctl3/pkg/uuid"
+)
+
+// Server serves the management API of a registry:
+//
+//	GET    /api/state
+//	GET    /api/devices
+//	GET    /api/devices/{id}
+//	POST   /api/devices/{id}/adopt
+//	POST   /api/devices/{id}/reset
+//	PUT    /api/inputs/{id}/config
+//	POST   /api/inputs/{id}/assisted-setup
+//	GET    /api/discovered
+//	GET    /api/profiles
+//	POST   /api/profiles
+//	GET    /api/profiles/{id}
+//	PUT    /api/profiles/{id}
+//	DELETE /api/profiles/{id}
+//	GET    /api/profiles/{id}/status
+//	POST   /api/profiles/{id}/enable
+//	POST   /api/profiles/{id}/disable
+//
+// Every request must carry the token the server was created with as a bearer
+// token in the Authorization header.
+type Server struct {
+	reg   *registry.Registry
+	token string
+}
+
+func New(reg *registry.Registry, token string) *Server {
+	return &Server{
+		reg:   reg,
+		token: token,
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+
+	// Fields lists the invalid config fields of a rejected profile.
+	Fields []registry.FieldError `json:"fields,omitempty"`
+}
+
+// profileRequest is the body of requests that create or update a profile.
+type profileRequest struct {
+	Name string              `json:"name"`
+	IO   []registry.IOConfig `json:"io"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/api/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch parts[0] {
+	case "state":
+		s.serveState(w, r, parts[1:])
+	case "devices":
+		s.serveDevices(w, r, parts[1:])
+	case "inputs":
+		s.serveInputs(w, r, parts[1:])
+	case "discovered":
+		s.serveDiscovered(w, r, parts[1:])
+	case "profiles":
+		s.serveProfiles(w, r, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+
+	b, err := s.reg.MarshalState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (s *Server) serveDevices(w http.ResponseWriter, r *http.Request, parts []string) {
+	var id uuid.UUID
+	if len(parts) > 0 {
+		var ok bool
+		id, ok = parseId(w, parts[0])
+		if !ok {
+			return
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, s.reg.Devices())
+	case 1:
+		if !allow(w, r, http.MethodGet) {
+			return
+		}
+
+		dev, err := s.reg.Device(id)
+		if err != nil {
+			writeError(w, statusCode(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, dev)
+	case 2:
+		var action func(id uuid.UUID) error
+		switch parts[1] {
+		case "adopt":
+			action = s.reg.AdoptDevice
+		case "reset":
+			action = s.reg.ResetDevice
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+
+		err := action(id)
+		if err != nil {
+			writeError(w, statusCode(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveInputs(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, ok := parseId(w, parts[0])
+	if !ok {
+		return
+	}
+
+	switch parts[1] {
+	case "config":
+		if !allow(w, r, http.MethodPut) {
+			return
+		}
+
+		var config map[string]any
+		err := json.NewDecoder(r.Body).Decode(&config)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		config, err = s.reg.SetInputConfig(id, config)
+		if err != nil {
+			writeError(w, statusCode(err), err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, config)
+	case "assisted-setup":
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+
+		// the proposed config is reported with the input, see /api/devices
+		err := s.reg.RequestAssistedSetup(id)
+		if err != nil {
+			writeError(w, statusCode(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveDiscovered(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.reg.Discovered())
+}
+
+func (s *Server) serveProfiles(w http.ResponseWriter, r *http.Request, parts []string) {
+	var id uuid.UUID
+	if len(parts) > 0 {
+		var ok bool
+		id, ok = parseId(w, parts[0])
+		if !ok {
+			return
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.reg.Profiles())
+		case http.MethodPost:
+			var req profileRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			prof, err := s.reg.CreateProfile(req.Name, req.IO)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, prof)
+		default:
+			allow(w, r, http.MethodGet, http.MethodPost)
+		}
+	case 1:
+		switch r.Method {
+		case http.MethodGet:
+			prof, err := s.reg.Profile(id)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, prof)
+		case http.MethodPut:
+			var req profileRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			// the name is kept if the request does not carry one
+			prof, err := s.reg.UpdateProfile(id, req.Name, req.IO)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, prof)
+		case http.MethodDelete:
+			err := s.reg.DeleteProfile(id)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			allow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	case 2:
+		switch parts[1] {
+		case "status":
+			if !allow(w, r, http.MethodGet) {
+				return
+			}
+
+			status, err := s.reg.ProfileStatus(id)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, status)
+		case "enable":
+			if !allow(w, r, http.MethodPost) {
+				return
+			}
+
+			status, err := s.reg.EnableProfile(id)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, status)
+		case "disable":
+			if !allow(w, r, http.MethodPost) {
+				return
+			}
+
+			err := s.reg.DisableProfile(id)
+			if err != nil {
+				writeError(w, statusCode(err), err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func parseId(w http.ResponseWriter, s string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id %q", s))
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// allow replies with 405 Method Not Allowed unless the request uses one of
+// the given methods.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+
+	return false
+}
+
+// authorized reports whether the request carries the token of the server. An
+// empty token authorizes nothing.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || s.token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// statusCode maps an error returned by the registry to a response status.
+// Requests the registry rejects in its current state are conflicts.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, registry.ErrProfileNotFound), errors.Is(err, registry.ErrDeviceNotFound),
+		errors.Is(err, registry.ErrInputNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, registry.ErrEmptyIO), errors.Is(err, registry.ErrEmptyName),
+		errors.As(err, new(*registry.ValidationError)):
+		return http.StatusBadRequest
+	default:
+		return http.StatusConflict
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Println("error writing response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	resp := errorResponse{Error: err.Error()}
+
+	var verr *registry.ValidationError
+	if errors.As(err, &verr) {
+		resp.Fields = verr.Fields
+	}
+
+	writeJSON(w, status, resp)
+}
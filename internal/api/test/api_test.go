@@ -0,0 +1,200 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/internal/api"
+	"ledctl3/internal/registry"
+	"ledctl3/pkg/uuid"
+)
+
+type mockStateHolder struct{}
+
+func (m mockStateHolder) SetState(state registry.State) error {
+	return nil
+}
+
+func (m mockStateHolder) GetState() (registry.State, error) {
+	return registry.State{}, nil
+}
+
+// mockTransport discards the events written by the registry.
+type mockTransport struct{}
+
+func (m mockTransport) Start() error {
+	return nil
+}
+
+func (m mockTransport) Dial(addr string) error {
+	return errors.New("not supported")
+}
+
+func (m mockTransport) Write(addr string, e event.Event) error {
+	return nil
+}
+
+func (m mockTransport) Close(addr string) error {
+	return nil
+}
+
+func (m mockTransport) SetMessageHandler(h func(addr string, e event.Event)) {}
+
+func (m mockTransport) SetConnectHandler(h func(addr string)) {}
+
+func (m mockTransport) SetDisconnectHandler(h func(addr string)) {}
+
+const token = "secret"
+
+func do(t *testing.T, srv *httptest.Server, method, path string, body any, v any) int {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		assert.NilError(t, json.NewEncoder(&buf).Encode(body))
+	}
+
+	req, err := http.NewRequest(method, srv.URL+path, &buf)
+	assert.NilError(t, err)
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+
+	if v != nil {
+		assert.NilError(t, json.NewDecoder(res.Body).Decode(v))
+	}
+
+	return res.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	reg := registry.New(mockStateHolder{}, mockTransport{})
+
+	devId := uuid.New()
+	inId := uuid.New()
+	outId := uuid.New()
+
+	addr := uuid.New().String()
+	assert.NilError(t, reg.ProcessEvent(addr, event.Connect{Id: devId, Version: event.ProtocolVersion}))
+	assert.NilError(t, reg.ProcessEvent(addr, event.InputConnected{Id: inId}))
+	assert.NilError(t, reg.ProcessEvent(addr, event.OutputConnected{Id: outId, Leds: 40}))
+
+	srv := httptest.NewServer(api.New(reg, token))
+	defer srv.Close()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := http.Get(srv.URL + "/api/devices")
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/devices", nil)
+		assert.NilError(t, err)
+		req.Header.Set("Authorization", "Bearer wrong")
+
+		res, err = http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		res.Body.Close()
+		assert.Equal(t, res.StatusCode, http.StatusUnauthorized)
+	})
+
+	t.Run("list devices", func(t *testing.T) {
+		var devs []registry.DeviceStatus
+		assert.Equal(t, do(t, srv, http.MethodGet, "/api/devices", nil, &devs), http.StatusOK)
+		assert.Equal(t, len(devs), 1)
+		assert.Equal(t, devs[0].Id, devId)
+		assert.Equal(t, devs[0].Connected, true)
+		assert.Equal(t, devs[0].Inputs[0].Id, inId)
+		assert.Equal(t, devs[0].Outputs[0].Leds, 40)
+	})
+
+	t.Run("unknown device", func(t *testing.T) {
+		assert.Equal(t, do(t, srv, http.MethodGet, "/api/devices/"+uuid.New().String(), nil, nil), http.StatusNotFound)
+		assert.Equal(t, do(t, srv, http.MethodGet, "/api/devices/invalid", nil, nil), http.StatusBadRequest)
+	})
+
+	var prof registry.Profile
+	t.Run("create profile", func(t *testing.T) {
+		body := map[string]any{
+			"name": "test",
+			"io":   []registry.IOConfig{{InputId: inId, OutputId: outId}},
+		}
+
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/profiles", body, &prof), http.StatusCreated)
+		assert.Equal(t, prof.Name, "test")
+
+		var got registry.Profile
+		assert.Equal(t, do(t, srv, http.MethodGet, "/api/profiles/"+prof.Id.String(), nil, &got), http.StatusOK)
+		assert.DeepEqual(t, got, prof)
+	})
+
+	t.Run("create profile without io", func(t *testing.T) {
+		body := map[string]any{"name": "empty"}
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/profiles", body, nil), http.StatusBadRequest)
+	})
+
+	t.Run("update profile", func(t *testing.T) {
+		var got registry.Profile
+
+		body := map[string]any{"io": prof.IO}
+		assert.Equal(t, do(t, srv, http.MethodPut, "/api/profiles/"+prof.Id.String(), body, &got), http.StatusOK)
+		assert.Equal(t, got.Name, "test")
+
+		body = map[string]any{"name": "renamed", "io": prof.IO}
+		assert.Equal(t, do(t, srv, http.MethodPut, "/api/profiles/"+prof.Id.String(), body, &got), http.StatusOK)
+		assert.Equal(t, got.Name, "renamed")
+
+		// nothing is applied if the update is rejected
+		body = map[string]any{"name": "rejected"}
+		assert.Equal(t, do(t, srv, http.MethodPut, "/api/profiles/"+prof.Id.String(), body, nil), http.StatusBadRequest)
+
+		assert.Equal(t, do(t, srv, http.MethodGet, "/api/profiles/"+prof.Id.String(), nil, &got), http.StatusOK)
+		assert.Equal(t, got.Name, "renamed")
+	})
+
+	t.Run("enable profile", func(t *testing.T) {
+		var status []registry.IOStatus
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/profiles/"+prof.Id.String()+"/enable", nil, &status), http.StatusOK)
+		assert.Equal(t, len(status), 1)
+		assert.Equal(t, status[0].State, registry.IOStatePending)
+
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/profiles/"+prof.Id.String()+"/enable", nil, nil), http.StatusConflict)
+	})
+
+	t.Run("state", func(t *testing.T) {
+		reg.SetPairingRequired(true)
+
+		pendingId := uuid.New()
+		assert.NilError(t, reg.ProcessEvent(uuid.New().String(), event.Connect{Id: pendingId, Version: event.ProtocolVersion}))
+		assert.Assert(t, reg.State.Devices[pendingId].TokenHash != "")
+
+		var state registry.State
+		assert.Equal(t, do(t, srv, http.MethodGet, "/api/state", nil, &state), http.StatusOK)
+		assert.DeepEqual(t, state.ActiveProfiles, []uuid.UUID{prof.Id})
+
+		// credential hashes are not exposed
+		assert.Equal(t, state.Devices[pendingId].Pending, true)
+		assert.Equal(t, state.Devices[pendingId].TokenHash, "")
+	})
+
+	t.Run("reset device", func(t *testing.T) {
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/devices/"+devId.String()+"/reset", nil, nil), http.StatusNoContent)
+		assert.Equal(t, reg.State.Devices[devId].Pending, true)
+
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/devices/"+uuid.New().String()+"/reset", nil, nil), http.StatusNotFound)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		assert.Equal(t, do(t, srv, http.MethodPost, "/api/devices", nil, nil), http.StatusMethodNotAllowed)
+	})
+}
@@ -16,6 +16,14 @@ type Input interface {
 	AssistedSetup() map[string]any
 }
 
+// ConfigurableInput is implemented by inputs that can apply a config change
+// while running. ApplyConfig returns the config that is in effect, which may
+// differ from the requested one if the input had to adjust it.
+type ConfigurableInput interface {
+	Input
+	ApplyConfig(cfg map[string]any) (map[string]any, error)
+}
+
 type Output interface {
 	Id() uuid.UUID
 	Render([]color.Color)
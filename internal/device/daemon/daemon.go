@@ -0,0 +1,325 @@
+// Package daemon runs a device process: it connects the device to the
+// registry over the configured transport, advertises it and keeps its
+// credential. The binaries only add their inputs and outputs.
+package daemon
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"ledctl3/event"
+	"ledctl3/internal/device"
+	"ledctl3/pkg/connector"
+	"ledctl3/pkg/dataplane"
+	"ledctl3/pkg/discovery"
+	"ledctl3/pkg/mdns"
+	"ledctl3/pkg/netserver"
+	"ledctl3/pkg/transport"
+	"ledctl3/pkg/uuid"
+	"ledctl3/pkg/wsserver"
+)
+
+const (
+	heartbeatInterval = 1 * time.Second
+	readTimeout       = 5 * time.Second
+	// queueStatsInterval is how often connections that fall behind and
+	// drop realtime data are reported.
+	queueStatsInterval = 10 * time.Second
+)
+
+type Config struct {
+	Transport string    `json:"transport"`
+	DataPort  int       `json:"data_port"`
+	DeviceId  uuid.UUID `json:"device_id"`
+	Name      string    `json:"name"`
+
+	// ListenPort lets the registry connect to the device. Zero disables it.
+	ListenPort int `json:"listen_port"`
+
+	// TLS encrypts the link to the registry. TLSCA is the path of a PEM
+	// encoded certificate the registry certificate is verified against; the
+	// system roots are used if it is empty. Devices that listen for
+	// connections present the certificate in TLSCert and TLSKey.
+	TLS           bool   `json:"tls"`
+	TLSCA         string `json:"tls_ca"`
+	TLSServerName string `json:"tls_server_name"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key"`
+
+	// Discovery lists the methods used to find the registry, in order:
+	// "mdns", "static" (RegistryAddrs) and "broadcast" (ProbeAddr). It
+	// defaults to "mdns", unless the device listens for connections, in
+	// which case it does not dial the registry at all.
+	Discovery     []string `json:"discovery"`
+	RegistryAddrs []string `json:"registry_addrs"`
+	ProbeAddr     string   `json:"probe_addr"`
+}
+
+// advertisedPort is advertised over mDNS by devices that do not accept
+// connections, as service records need a port.
+const advertisedPort = 9
+
+// tokenFile holds the credential issued by the registry when the device was
+// paired with it.
+const tokenFile = "../device.token"
+
+// Daemon holds a device along with the transport and the advertiser it is
+// reached through.
+type Daemon struct {
+	cfg Config
+	t   transport.Transport[event.Event]
+
+	// Device is the device run by the daemon. Inputs and outputs must be
+	// added to it before Run.
+	Device *device.Device
+}
+
+// New creates the device described by cfg, advertises it and, if the config
+// asks for it, sets up its data plane. Missing config values are defaulted.
+func New(cfg Config) (*Daemon, error) {
+	if cfg.Transport == "" {
+		cfg.Transport = "tcp"
+	}
+
+	if cfg.Name == "" {
+		cfg.Name, _ = os.Hostname()
+	}
+
+	if len(cfg.Discovery) == 0 && cfg.ListenPort == 0 {
+		cfg.Discovery = []string{"mdns"}
+	}
+
+	if cfg.ProbeAddr == "" {
+		cfg.ProbeAddr = fmt.Sprintf("255.255.255.255:%d", discovery.DefaultProbePort)
+	}
+
+	s, codecs, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := readToken()
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := device.New(
+		device.Config{
+			Id:     cfg.DeviceId,
+			Codecs: codecs,
+			Token:  token,
+		},
+		s)
+	if err != nil {
+		return nil, err
+	}
+
+	advertised := mdns.Device{
+		Id:        cfg.DeviceId,
+		Name:      cfg.Name,
+		Listening: cfg.ListenPort != 0,
+	}
+
+	mdnsPort := advertisedPort
+	if cfg.ListenPort != 0 {
+		mdnsPort = cfg.ListenPort
+	}
+
+	advertiser, err := mdns.NewDeviceServer(cfg.DeviceId.String(), mdnsPort, mdns.DeviceText(advertised)...)
+	if err != nil {
+		return nil, err
+	}
+
+	dev.SetIOHandler(func(inputs, outputs int) {
+		advertised := advertised
+		advertised.Inputs = inputs
+		advertised.Outputs = outputs
+
+		advertiser.SetText(mdns.DeviceText(advertised)...)
+	})
+
+	err = advertiser.Start()
+	if err != nil {
+		// discovery of the device is optional
+		fmt.Println("error advertising device:", err)
+	}
+
+	dev.SetPairedHandler(func(token string) {
+		err := os.WriteFile(tokenFile, []byte(token), 0600)
+		if err != nil {
+			fmt.Println("error writing token:", err)
+		}
+	})
+
+	if cfg.DataPort != 0 {
+		dp := dataplane.New[event.Event](cfg.DataPort, event.Codec)
+
+		dp.SetMessageHandler(func(addr string, e event.Event) {
+			dev.ProcessData(addr, e)
+		})
+
+		err = dp.Start()
+		if err != nil {
+			return nil, err
+		}
+
+		dev.SetDataPlane(dp.Port(), dp.Write)
+	}
+
+	return &Daemon{
+		cfg:    cfg,
+		t:      s,
+		Device: dev,
+	}, nil
+}
+
+// Run accepts connections from the registry if the device listens for them,
+// and otherwise keeps connecting to the registries that are discovered. It
+// only returns on error.
+func (d *Daemon) Run() error {
+	if d.cfg.ListenPort != 0 {
+		err := d.t.Start()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println(d.cfg.DeviceId, "started")
+
+	if len(d.cfg.Discovery) == 0 {
+		// wait for the registry to connect
+		select {}
+	}
+
+	fmt.Println("resolving registry address")
+
+	disc, err := newDiscovery(d.cfg)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := disc.Discover(context.Background())
+	if err != nil {
+		return err
+	}
+
+	conn := connector.New(func(addr net.Addr) error {
+		return d.t.Dial(addr.String())
+	})
+
+	go func() {
+		for addr := range addrs {
+			conn.AddAddr(addr)
+		}
+	}()
+
+	return conn.Run(context.Background())
+}
+
+// newTransport creates the transport named in cfg, along with the names of
+// the codecs it speaks.
+func newTransport(cfg Config) (transport.Transport[event.Event], []string, error) {
+	port := cfg.ListenPort
+	if port == 0 {
+		port = -1
+	}
+
+	switch cfg.Transport {
+	case "tcp":
+		ns := netserver.New[event.Event](port, event.Codec)
+		ns.SetHeartbeatInterval(heartbeatInterval)
+		ns.SetReadTimeout(readTimeout)
+		ns.SetWritePolicy(netserver.WritePolicy[event.Event]{
+			Droppable: event.Droppable,
+			Replaces:  event.Replaces,
+		})
+
+		go ns.ReportQueueStats(context.Background(), queueStatsInterval)
+
+		if cfg.TLS {
+			tlsCfg, err := tlsConfig(cfg)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			ns.SetTLSConfig(tlsCfg)
+		}
+
+		return ns, []string{event.Codec.Name()}, nil
+	case "ws":
+		if cfg.TLS {
+			return nil, nil, errors.New("tls is only supported by the tcp transport")
+		}
+
+		return wsserver.New[event.Event](port, event.JSONCodec), []string{event.JSONCodec.Name()}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName: cfg.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.TLSCA != "" {
+		b, err := os.ReadFile(cfg.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("invalid tls ca")
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+func newDiscovery(cfg Config) (discovery.Discovery, error) {
+	var ds []discovery.Discovery
+	for _, method := range cfg.Discovery {
+		switch method {
+		case "mdns":
+			ds = append(ds, discovery.MDNS(event.CompatibleVersion))
+		case "static":
+			ds = append(ds, discovery.Static(cfg.RegistryAddrs...))
+		case "broadcast":
+			ds = append(ds, discovery.Broadcast(cfg.ProbeAddr, discovery.DefaultProbeInterval))
+		default:
+			return nil, fmt.Errorf("unknown discovery method %q", method)
+		}
+	}
+
+	return discovery.Chain(discovery.DefaultFallbackDelay, ds...), nil
+}
+
+func readToken() (string, error) {
+	b, err := os.ReadFile(tokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -2,44 +2,162 @@ package device
 
 import (
 	"fmt"
+	"slices"
 	"sync"
 
 	"ledctl3/event"
 	"ledctl3/internal/device/common"
+	"ledctl3/pkg/pixfmt"
+	"ledctl3/pkg/transport"
 	"ledctl3/pkg/uuid"
 )
 
+// features lists the optional protocol features supported by the device.
+var features = []event.Feature{
+	event.FeatureInputConfig,
+	event.FeatureAssistedSetup,
+}
+
 type Device struct {
-	id      uuid.UUID
-	mux     sync.Mutex
-	write   func(addr string, e event.Event) error
-	cfg     Config
-	inputs  map[uuid.UUID]common.Input
-	outputs map[uuid.UUID]common.Output
-	regAddr string
+	id       uuid.UUID
+	mux      sync.Mutex
+	write    func(addr string, e event.Event) error
+	close    func(addr string) error
+	cfg      Config
+	inputs   map[uuid.UUID]common.Input
+	outputs  map[uuid.UUID]common.Output
+	decoders map[uuid.UUID]*pixfmt.Decoder
+	regAddr  string
+	features []event.Feature
+	// negotiated lists the features the registry agreed to use on the
+	// current connection.
+	negotiated []event.Feature
+
+	dataPort  int
+	dataWrite func(addr string, e event.Event) error
+	dataAddr  string
+
+	token         string
+	pairedHandler func(token string)
+	ioHandler     func(inputs, outputs int)
+
+	// sessions holds the last SetInputActive applied to each input, so that
+	// inputs can be resumed without waiting for the registry.
+	sessions map[uuid.UUID]event.SetInputActive
 }
 
 type Config struct {
 	Id uuid.UUID
+	// Codecs lists the codecs the device is able to speak, in order of
+	// preference.
+	Codecs []string
+	// Token is the credential the device was issued when it was paired with
+	// the registry.
+	Token string
+}
+
+// New creates a device that talks to the registry over the given transport.
+// It takes over the message, connect and disconnect handlers of the
+// transport.
+func New(cfg Config, t transport.Transport[event.Event]) (*Device, error) {
+	s := &Device{
+		id:       cfg.Id,
+		write:    t.Write,
+		close:    t.Close,
+		cfg:      cfg,
+		inputs:   make(map[uuid.UUID]common.Input),
+		outputs:  make(map[uuid.UUID]common.Output),
+		decoders: make(map[uuid.UUID]*pixfmt.Decoder),
+		sessions: make(map[uuid.UUID]event.SetInputActive),
+		features: slices.Clone(features),
+		token:    cfg.Token,
+	}
+
+	t.SetMessageHandler(func(addr string, e event.Event) {
+		s.ProcessEvent(addr, e)
+	})
+
+	t.SetConnectHandler(func(addr string) {
+		s.ProcessEvent(addr, event.Connect{})
+	})
+
+	t.SetDisconnectHandler(func(addr string) {
+		s.ProcessEvent(addr, event.Disconnect{})
+	})
+
+	return s, nil
 }
 
-func New(cfg Config, write func(addr string, e event.Event) error) (*Device, error) {
-	return &Device{
-		id:      cfg.Id,
-		write:   write,
-		cfg:     cfg,
-		inputs:  make(map[uuid.UUID]common.Input),
-		outputs: make(map[uuid.UUID]common.Output),
-	}, nil
+// SetIOHandler sets a handler that is called with the number of inputs and
+// outputs of the device whenever one is added or removed.
+func (s *Device) SetIOHandler(h func(inputs, outputs int)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.ioHandler = h
+}
+
+func (s *Device) ioChanged() {
+	s.mux.Lock()
+	h := s.ioHandler
+	inputs, outputs := len(s.inputs), len(s.outputs)
+	s.mux.Unlock()
+
+	if h != nil {
+		h(inputs, outputs)
+	}
+}
+
+// SetPairedHandler sets a handler that is called when the registry issues a
+// new credential to the device, so that it can be persisted and presented on
+// subsequent connections.
+func (s *Device) SetPairedHandler(h func(token string)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.pairedHandler = h
+}
+
+// SetDataPlane enables the UDP data plane if the registry supports it. Port
+// is the local UDP port the device receives realtime data on, and write
+// sends an event to the data address of the registry.
+func (s *Device) SetDataPlane(port int, write func(addr string, e event.Event) error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.dataPort = port
+	s.dataWrite = write
+
+	if !slices.Contains(s.features, event.FeatureUDPData) {
+		s.features = append(s.features, event.FeatureUDPData)
+	}
 }
 
 func (s *Device) AddInput(in common.Input) {
 	//fmt.Println("ADD INPUT CALLED", in)
 
+	s.mux.Lock()
 	s.inputs[in.Id()] = in
 	//s.inputCfgs[in.Id()] = inputConfig{}
+	e, ok := s.sessions[in.Id()]
+	s.mux.Unlock()
+
+	s.ioChanged()
+
+	if ok {
+		// the input was active before it went away
+		err := startInput(in, e)
+		if err != nil {
+			fmt.Println("error resuming input", in.Id(), err)
+		}
+	}
 
 	go func() {
+		// frames are diffed against the last keyframe sent to the registry,
+		// so encoders are reset whenever the registry connection changes
+		encoders := make(map[uuid.UUID]*pixfmt.Encoder)
+		var encAddr string
+
 		// forward messages from input to the network
 		for e := range in.Events() {
 
@@ -47,33 +165,67 @@ func (s *Device) AddInput(in common.Input) {
 				// deliver to local device outputs
 
 				for _, out := range e.Outputs {
-					if _, ok := s.outputs[out.OutputId]; !ok {
+					s.mux.Lock()
+					o, ok := s.outputs[out.OutputId]
+					s.mux.Unlock()
+
+					if !ok {
 						fmt.Println("output not found", out.OutputId)
 						continue
 					}
 
-					s.outputs[out.OutputId].Render(out.Pix)
+					o.Render(out.Pix)
 				}
 
 				continue
 			}
 
+			// the connection state changes as the registry comes and goes,
+			// so it is read once per event
+			s.mux.Lock()
+			regAddr, dataAddr, dataWrite := s.regAddr, s.dataAddr, s.dataWrite
+			s.mux.Unlock()
+
+			if regAddr == "" {
+				continue
+			}
+
+			if regAddr != encAddr {
+				encoders = make(map[uuid.UUID]*pixfmt.Encoder)
+				encAddr = regAddr
+			}
+
 			var outputs []event.DataOutput
 			for _, output := range e.Outputs {
+				enc, ok := encoders[output.OutputId]
+				if !ok {
+					enc = pixfmt.NewEncoder(pixfmt.RGB, pixfmt.DefaultKeyframeInterval)
+					encoders[output.OutputId] = enc
+				}
+
+				frame, err := enc.Encode(output.Pix)
+				if err != nil {
+					fmt.Println("encode error:", err)
+					continue
+				}
+
 				outputs = append(outputs, event.DataOutput{
-					Id:  output.OutputId,
-					Pix: output.Pix,
+					Id:    output.OutputId,
+					Frame: frame,
 				})
 			}
 
-			if s.regAddr == "" {
-				continue
-			}
-
-			err := s.write(s.regAddr, event.Data{
+			data := event.Data{
 				SinkId:  e.SinkId,
 				Outputs: outputs,
-			})
+			}
+
+			var err error
+			if dataAddr != "" {
+				err = dataWrite(dataAddr, data)
+			} else {
+				err = s.write(regAddr, data)
+			}
 			if err != nil {
 				fmt.Println("write error:", err)
 			}
@@ -92,19 +244,32 @@ func (s *Device) AddInput(in common.Input) {
 
 func (s *Device) RemoveInput(id uuid.UUID) {
 	//fmt.Println("RemoveInput CALLED", id)
+	s.mux.Lock()
 	delete(s.inputs, id)
+	s.mux.Unlock()
+
+	s.ioChanged()
 }
 
 func (s *Device) AddOutput(out common.Output) {
 	//fmt.Println("ADD OUTPUT CALLED", out)
 
+	s.mux.Lock()
 	s.outputs[out.Id()] = out
+	s.mux.Unlock()
+
+	s.ioChanged()
 }
 
 func (s *Device) RemoveOutput(id uuid.UUID) {
 	//fmt.Println("REMOVE OUTPUT CALLED", id)
 
+	s.mux.Lock()
 	delete(s.outputs, id)
+	delete(s.decoders, id)
+	s.mux.Unlock()
+
+	s.ioChanged()
 }
 
 func (s *Device) handleData(addr string, e event.Data) {
@@ -114,6 +279,39 @@ func (s *Device) handleData(addr string, e event.Data) {
 			continue
 		}
 
-		s.outputs[out.Id].Render(out.Pix)
+		dec, ok := s.decoders[out.Id]
+		if !ok {
+			dec = pixfmt.NewDecoder()
+			s.decoders[out.Id] = dec
+		}
+
+		pix, err := dec.Decode(out.Frame)
+		if err != nil {
+			fmt.Println("decode error:", err)
+			continue
+		}
+
+		s.outputs[out.Id].Render(pix)
 	}
 }
+
+// ProcessData handles an event received over the data plane. The data plane
+// is not authenticated, so only Data events sent from the data address of the
+// registry are accepted; anything else is dropped.
+func (s *Device) ProcessData(addr string, e event.Event) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	data, ok := e.(event.Data)
+	if !ok {
+		fmt.Printf("%s: dropping %T on data plane\n", addr, e)
+		return
+	}
+
+	if s.dataAddr == "" || addr != s.dataAddr {
+		fmt.Printf("%s: dropping data from unknown peer\n", addr)
+		return
+	}
+
+	s.handleData(addr, data)
+}
@@ -3,9 +3,16 @@ package device
 import (
 	"encoding/json"
 	"fmt"
+	"image/color"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
 
 	"ledctl3/event"
+	"ledctl3/internal/device/common"
 	"ledctl3/internal/device/types"
+	"ledctl3/pkg/uuid"
 )
 
 func (s *Device) ProcessEvent(addr string, e event.Event) {
@@ -17,14 +24,30 @@ func (s *Device) ProcessEvent(addr string, e event.Event) {
 	switch e := e.(type) {
 	case event.Connect:
 		s.handleConnect(addr, e)
+	case event.ConnectAck:
+		s.handleConnectAck(addr, e)
 	case event.Disconnect:
 		s.handleDisconnect(addr, e)
 	//case event.SetSourceActive:
 	//	s.handleSetSourceActive(addr, e)
 	case event.SetInputActive:
 		s.handleSetInputActive(addr, e)
+	case event.SetSourceIdle:
+		s.handleSetSourceIdle(addr, e)
+	case event.SetSinkIdle:
+		s.handleSetSinkIdle(addr, e)
+	case event.SetInputConfig:
+		s.handleSetInputConfig(addr, e)
+	case event.AssistedSetup:
+		s.handleAssistedSetup(addr, e)
 	case event.Data:
 		s.handleData(addr, e)
+	case event.DataChannel:
+		s.handleDataChannel(addr, e)
+	case event.Error:
+		s.handleError(addr, e)
+	case event.Paired:
+		s.handlePaired(addr, e)
 	//case event.ListCapabilities:
 	//	s.handleListCapabilitiesEvent(addr, e)
 	default:
@@ -37,9 +60,31 @@ func (s *Device) ProcessEvent(addr string, e event.Event) {
 func (s *Device) handleConnect(addr string, e event.Connect) {
 	fmt.Printf("%s: recv Connect\n", addr)
 
+	if s.regAddr != "" && s.regAddr != addr {
+		// a registry that reaches the device both ways, e.g. through a
+		// static address and discovery, must not drive it twice
+		fmt.Printf("%s: send Error\n", addr)
+
+		err := s.write(addr, event.Error{
+			Code:   event.ErrorCodeAlreadyConnected,
+			Reason: "device is connected to " + s.regAddr,
+		})
+		if err != nil {
+			fmt.Println("error writing to addr", addr, err)
+		}
+
+		s.hangUp(addr)
+		return
+	}
+
 	fmt.Printf("%s: send Connect\n", addr)
 	err := s.write(addr, event.Connect{
-		Id: s.cfg.Id,
+		Id:       s.cfg.Id,
+		Version:  event.ProtocolVersion,
+		Codecs:   s.cfg.Codecs,
+		Features: s.features,
+		DataPort: s.dataPort,
+		Token:    s.token,
 	})
 	if err != nil {
 		fmt.Println("error writing to addr", addr, err)
@@ -51,7 +96,8 @@ func (s *Device) handleConnect(addr string, e event.Connect) {
 		err := s.write(addr, event.InputConnected{
 			Id: in.Id(),
 			//Type:   event.InputTypeDefault,
-			//Schema: in.Schema(),
+			Schema:  in.Schema(),
+			Outputs: s.sessions[in.Id()].Outputs,
 		})
 		if err != nil {
 			fmt.Println("error writing to addr", addr, err)
@@ -73,12 +119,93 @@ func (s *Device) handleConnect(addr string, e event.Connect) {
 	}
 
 	s.regAddr = addr
+
+	s.resumeInputs()
+}
+
+func (s *Device) handleConnectAck(addr string, e event.ConnectAck) {
+	fmt.Printf("%s: recv ConnectAck\n", addr)
+
+	err := event.CompatibleVersion(e.Version)
+	if err != nil {
+		// stop sending data to a registry the device cannot talk to
+		fmt.Println("registry rejected:", err)
+		s.regAddr = ""
+		s.hangUp(addr)
+		return
+	}
+
+	// a registry that does not list the codecs is taken to speak the one
+	// the device connected with
+	if len(e.Codecs) > 0 && len(event.NegotiateCodecs(s.cfg.Codecs, e.Codecs)) == 0 {
+		fmt.Println("registry rejected: no common codec")
+		s.regAddr = ""
+		s.hangUp(addr)
+		return
+	}
+
+	s.negotiated = e.Features
 }
 
 func (s *Device) handleDisconnect(addr string, _ event.Disconnect) {
 	fmt.Printf("%s: recv Disconnect\n", addr)
 
+	if addr != s.regAddr {
+		// a refused connection, the registry is still connected
+		return
+	}
+
 	s.regAddr = ""
+	s.dataAddr = ""
+	s.negotiated = nil
+}
+
+func (s *Device) handleDataChannel(addr string, e event.DataChannel) {
+	fmt.Printf("%s: recv DataChannel\n", addr)
+
+	if !slices.Contains(s.negotiated, event.FeatureUDPData) {
+		fmt.Println("data channel was not negotiated")
+		return
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		fmt.Println("invalid registry address", addr, err)
+		return
+	}
+
+	s.dataAddr = net.JoinHostPort(host, strconv.Itoa(e.Port))
+}
+
+func (s *Device) handleError(addr string, e event.Error) {
+	fmt.Printf("%s: recv Error: %s: %s\n", addr, e.Code, e.Reason)
+
+	switch e.Code {
+	case event.ErrorCodeIncompatibleVersion, event.ErrorCodeIncompatibleCodec, event.ErrorCodeUnauthorized:
+		// the registry refused the connection, so stop sending data to it
+		// and hang up, so that the next registry can be tried
+		if addr == s.regAddr {
+			s.regAddr = ""
+		}
+		s.hangUp(addr)
+	}
+}
+
+func (s *Device) hangUp(addr string) {
+	err := s.close(addr)
+	if err != nil {
+		fmt.Println("error closing connection:", err)
+	}
+}
+
+func (s *Device) handlePaired(addr string, e event.Paired) {
+	fmt.Printf("%s: recv Paired\n", addr)
+
+	s.token = e.Token
+
+	if s.pairedHandler != nil {
+		s.pairedHandler(e.Token)
+	}
 }
 
 //func (s *Device) handleListCapabilitiesEvent(addr string, _ event.ListCapabilities) {
@@ -160,9 +287,190 @@ func (s *Device) handleSetInputActive(addr string, e event.SetInputActive) {
 	in, ok := s.inputs[e.Id]
 	if !ok {
 		fmt.Println("in not found", e.Id)
+		s.fail(addr, e.RequestId, event.ErrorCodeInputNotFound, fmt.Sprintf("input %s not found", e.Id))
+		return
+	}
+
+	err = startInput(in, e)
+	if err != nil {
+		fmt.Println(err)
+		s.fail(addr, e.RequestId, event.ErrorCodeInputStartFailed, err.Error())
+		return
+	}
+
+	fmt.Println("input started", e.Id)
+
+	s.sessions[e.Id] = e
+
+	s.ack(addr, e.RequestId)
+}
+
+// handleSetSourceIdle stops feeding the given outputs from each input. Inputs
+// that are left without outputs are stopped, the rest are restarted with the
+// outputs they still feed.
+func (s *Device) handleSetSourceIdle(addr string, e event.SetSourceIdle) {
+	fmt.Printf("%s: recv SetSourceIdle\n", addr)
+
+	// every input is updated even if some fail; the reply carries the code
+	// of the first failure and the reasons of all of them
+	var code event.ErrorCode
+	var reasons []string
+	failed := func(c event.ErrorCode, reason string) {
+		if code == "" {
+			code = c
+		}
+
+		reasons = append(reasons, reason)
+	}
+
+	for _, input := range e.Inputs {
+		in, ok := s.inputs[input.InputId]
+		if !ok {
+			fmt.Println("in not found", input.InputId)
+			failed(event.ErrorCodeInputNotFound, fmt.Sprintf("input %s not found", input.InputId))
+			continue
+		}
+
+		sess, ok := s.sessions[input.InputId]
+		if !ok {
+			// the input is not feeding any outputs
+			continue
+		}
+
+		sess.Outputs = slices.DeleteFunc(slices.Clone(sess.Outputs), func(out event.SetInputActiveOutput) bool {
+			return slices.Contains(input.OutputIds, out.Id)
+		})
+
+		if len(sess.Outputs) == 0 {
+			delete(s.sessions, input.InputId)
+
+			err := in.Stop()
+			if err != nil {
+				fmt.Println(err)
+				failed(event.ErrorCodeInputStopFailed, fmt.Sprintf("input %s: %s", input.InputId, err))
+				continue
+			}
+
+			fmt.Println("input stopped", input.InputId)
+			continue
+		}
+
+		s.sessions[input.InputId] = sess
+
+		err := startInput(in, sess)
+		if err != nil {
+			fmt.Println(err)
+			failed(event.ErrorCodeInputStartFailed, fmt.Sprintf("input %s: %s", input.InputId, err))
+			continue
+		}
+
+		fmt.Println("input restarted", input.InputId)
+	}
+
+	if len(reasons) > 0 {
+		s.fail(addr, e.RequestId, code, strings.Join(reasons, "; "))
+		return
+	}
+
+	s.ack(addr, e.RequestId)
+}
+
+// handleSetSinkIdle blanks outputs that are no longer fed by any input.
+func (s *Device) handleSetSinkIdle(addr string, e event.SetSinkIdle) {
+	fmt.Printf("%s: recv SetSinkIdle\n", addr)
+
+	// every known output is blanked even if some are missing
+	var reasons []string
+
+	for _, id := range e.OutputIds {
+		out, ok := s.outputs[id]
+		if !ok {
+			fmt.Println("output not found", id)
+			reasons = append(reasons, fmt.Sprintf("output %s not found", id))
+			continue
+		}
+
+		pix := make([]color.Color, out.Leds())
+		for i := range pix {
+			pix[i] = color.Black
+		}
+
+		out.Render(pix)
+
+		// the next frame for the output starts a new stream
+		delete(s.decoders, id)
+	}
+
+	if len(reasons) > 0 {
+		s.fail(addr, e.RequestId, event.ErrorCodeOutputNotFound, strings.Join(reasons, "; "))
+		return
+	}
+
+	s.ack(addr, e.RequestId)
+}
+
+func (s *Device) handleSetInputConfig(addr string, e event.SetInputConfig) {
+	fmt.Printf("%s: recv SetInputConfig\n", addr)
+
+	in, ok := s.inputs[e.InputId]
+	if !ok {
+		fmt.Println("input not found", e.InputId)
+		s.fail(addr, e.RequestId, event.ErrorCodeInputNotFound, fmt.Sprintf("input %s not found", e.InputId))
+		return
+	}
+
+	cin, ok := in.(common.ConfigurableInput)
+	if !ok {
+		s.fail(addr, e.RequestId, event.ErrorCodeInputConfigFailed, "input cannot be configured")
+		return
+	}
+
+	applied, err := cin.ApplyConfig(e.Config)
+	if err != nil {
+		fmt.Println("error applying config:", err)
+		s.fail(addr, e.RequestId, event.ErrorCodeInputConfigFailed, err.Error())
+		return
+	}
+
+	fmt.Printf("%s: send InputConfigApplied\n", addr)
+
+	err = s.write(addr, event.InputConfigApplied{
+		RequestId: e.RequestId,
+		InputId:   e.InputId,
+		Config:    applied,
+	})
+	if err != nil {
+		fmt.Println("error writing to addr", addr, err)
+	}
+
+	s.ack(addr, e.RequestId)
+}
+
+func (s *Device) handleAssistedSetup(addr string, e event.AssistedSetup) {
+	fmt.Printf("%s: recv AssistedSetup\n", addr)
+
+	in, ok := s.inputs[e.InputId]
+	if !ok {
+		fmt.Println("input not found", e.InputId)
+		s.fail(addr, e.RequestId, event.ErrorCodeInputNotFound, fmt.Sprintf("input %s not found", e.InputId))
 		return
 	}
 
+	fmt.Printf("%s: send AssistedSetupConfig\n", addr)
+
+	err := s.write(addr, event.AssistedSetupConfig{
+		RequestId: e.RequestId,
+		InputId:   e.InputId,
+		Config:    in.AssistedSetup(),
+	})
+	if err != nil {
+		fmt.Println("error writing to addr", addr, err)
+	}
+
+	s.ack(addr, e.RequestId)
+}
+
+func startInput(in common.Input, e event.SetInputActive) error {
 	var outputCfgs []types.OutputConfig
 	for _, output := range e.Outputs {
 		outputCfgs = append(outputCfgs, types.OutputConfig{
@@ -173,14 +481,59 @@ func (s *Device) handleSetInputActive(addr string, e event.SetInputActive) {
 		})
 	}
 
-	err = in.Start(types.InputConfig{
+	return in.Start(types.InputConfig{
 		Framerate: 30,
 		Outputs:   outputCfgs,
 	})
+}
+
+// resumeInputs restarts every input from the last SetInputActive it was
+// given, so that it keeps feeding its outputs across registry reconnects
+// without waiting for the registry to replay its state.
+func (s *Device) resumeInputs() {
+	for id, e := range s.sessions {
+		in, ok := s.inputs[id]
+		if !ok {
+			continue
+		}
+
+		err := startInput(in, e)
+		if err != nil {
+			fmt.Println("error resuming input", id, err)
+			continue
+		}
+
+		fmt.Println("input resumed", id)
+	}
+}
+
+// ack acknowledges a request from the registry. Requests without an id are
+// sent by registries that do not expect a reply.
+func (s *Device) ack(addr string, requestId uuid.UUID) {
+	if requestId == "" {
+		return
+	}
+
+	err := s.write(addr, event.Ack{
+		RequestId: requestId,
+	})
 	if err != nil {
-		fmt.Println(err)
+		fmt.Println("error writing to addr", addr, err)
+	}
+}
+
+// fail reports a request from the registry that could not be applied.
+func (s *Device) fail(addr string, requestId uuid.UUID, code event.ErrorCode, reason string) {
+	if requestId == "" {
 		return
 	}
 
-	fmt.Println("input started", e.Id)
+	err := s.write(addr, event.Error{
+		RequestId: requestId,
+		Code:      code,
+		Reason:    reason,
+	})
+	if err != nil {
+		fmt.Println("error writing to addr", addr, err)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"image"
 )
 
 //go:generate go run github.com/atombender/go-jsonschema/cmd/gojsonschema -p screen --tags json -o schema.gen.go schema.json
@@ -12,6 +13,10 @@ import (
 var b []byte
 var schema map[string]any
 
+// maxFramerate matches the maximum of the framerate in schema.json. The
+// capture ticker cannot run at zero or beyond millisecond resolution.
+const maxFramerate = 240
+
 func init() {
 	_ = json.Unmarshal(b, &schema)
 }
@@ -20,14 +25,61 @@ func (in *Input) Schema() map[string]any {
 	return schema
 }
 
-func (in *Input) ApplyConfig(cfg map[string]any) error {
-	//var config SchemaJson
-	//err := json.Unmarshal(b, &config)
-	//if err != nil {
-	//	return err
-	//}
-
+// ApplyConfig changes the config of the input while it keeps feeding its
+// outputs. The capture region is clamped to the display, and the config that
+// is in effect afterwards is returned.
+func (in *Input) ApplyConfig(cfg map[string]any) (map[string]any, error) {
 	fmt.Printf("applying config: %#v\n", cfg)
 
-	return nil
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var config SchemaJson
+	err = json.Unmarshal(raw, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Framerate < 1 || config.Framerate > maxFramerate {
+		return nil, fmt.Errorf("framerate must be between 1 and %d", maxFramerate)
+	}
+
+	in.mux.Lock()
+	defer in.mux.Unlock()
+
+	d := in.display
+	bounds := image.Rect(d.X(), d.Y(), d.X()+d.Width(), d.Y()+d.Height())
+
+	region := image.Rect(config.Left, config.Top, config.Left+config.Width, config.Top+config.Height).Intersect(bounds)
+	if region.Empty() {
+		return nil, fmt.Errorf("capture region is outside of display %s", d)
+	}
+
+	config.Left = region.Min.X
+	config.Top = region.Min.Y
+	config.Width = region.Dx()
+	config.Height = region.Dy()
+
+	raw, err = json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied map[string]any
+	err = json.Unmarshal(raw, &applied)
+	if err != nil {
+		return nil, err
+	}
+
+	in.config = &config
+	in.region = region.Sub(bounds.Min)
+	in.cfg.Framerate = config.Framerate
+
+	if in.started {
+		d.SetFramerate(config.Framerate)
+	}
+
+	return applied, nil
 }
@@ -1,8 +1,10 @@
 package screen
 
 import (
-	"fmt"
+	"image"
 	"image/color"
+	"reflect"
+	"slices"
 	"sync"
 	"time"
 
@@ -25,6 +27,12 @@ type Input struct {
 	outputs map[uuid.UUID]outputCaptureConfig
 	started bool
 	cfg     types.InputConfig
+
+	// config is the last config applied with ApplyConfig, and region the
+	// part of the display it captures. The whole display is captured if
+	// region is empty.
+	config *SchemaJson
+	region image.Rectangle
 }
 
 func (in *Input) Events() <-chan types.UpdateEvent {
@@ -36,7 +44,6 @@ type outputCaptureConfig struct {
 	sinkId  uuid.UUID
 	leds    int
 	reverse bool
-	scaler  draw.Scaler
 }
 
 func (in *Input) AssistedSetup() map[string]any {
@@ -59,10 +66,14 @@ func (in *Input) Start(cfg types.InputConfig) error {
 	in.mux.Lock()
 	defer in.mux.Unlock()
 
-	if fmt.Sprintf("%+v", cfg) == fmt.Sprintf("%+v", in.cfg) {
-		fmt.Println("config unchanged")
+	if in.config != nil {
+		cfg.Framerate = in.config.Framerate
+	}
+
+	if in.started && reflect.DeepEqual(cfg, in.cfg) {
 		return nil
 	}
+
 	// reconfigure input and restart capture
 	in.started = true
 
@@ -70,9 +81,6 @@ func (in *Input) Start(cfg types.InputConfig) error {
 
 	in.outputs = make(map[uuid.UUID]outputCaptureConfig)
 
-	width := in.display.Width()
-	height := in.display.Width()
-
 	for _, out := range cfg.Outputs {
 		reverse, _ := out.Config["reverse"].(bool)
 
@@ -81,7 +89,6 @@ func (in *Input) Start(cfg types.InputConfig) error {
 			sinkId:  out.SinkId,
 			leds:    out.Leds,
 			reverse: reverse,
-			scaler:  draw.BiLinear.NewScaler(width, height, width/80, height/80),
 		}
 	}
 
@@ -89,195 +96,67 @@ func (in *Input) Start(cfg types.InputConfig) error {
 		in.capturer.captureCancel()
 	}
 
-	//in.display.Close()
-	//in.display.Capture(in.capturer.captureCtx, cfg.Framerate)
-	//if in.started {
-	//	in.cancel()
-	//	<-in.done
-	//	return errors.New("already started")
-	//}
-	//
-	//return in.capturer.startInput(in, cfg)
 	return nil
 }
 
 func (in *Input) Stop() error {
+	in.mux.Lock()
+	defer in.mux.Unlock()
+
 	in.started = false
 	in.cfg = types.InputConfig{
 		Framerate: 1,
 		Outputs:   nil,
 	}
-	in.capturer.captureCancel()
+	in.outputs = make(map[uuid.UUID]outputCaptureConfig)
+
+	if in.capturer.captureCancel != nil {
+		in.capturer.captureCancel()
+	}
+
 	return nil
 }
 
-//func (in *Input) StartDEPRECATED(cfg types.InputConfig) error {
-//	in.outputs = make(map[uuid.UUID]outputCaptureConfig)
-//
-//	width := in.display.Width()
-//	height := in.display.Width()
-//
-//	//for _, sinkCfg := range cfg.Outputs {
-//	for _, out := range cfg.Outputs {
-//		reverse, _ := out.Config["reverse"].(bool)
-//
-//		in.outputs[out.Id] = outputCaptureConfig{
-//			id:      out.Id,
-//			sinkId:  out.Id,
-//			leds:    out.Leds,
-//			reverse: reverse,
-//			scaler:  draw.BiLinear.NewScaler(width, height, width/80, height/80),
-//		}
-//	}
-//	//}
-//
-//	fmt.Printf("## starting screen capture with outputs config %#v\n", in.outputs)
-//
-//	//err := in.displays.Start()
-//	//if err != nil {
-//	//	return err
-//	//}
-//
-//	return nil
-//}
-
-//func (in *Input) startCapture() error {
-//	ctx, cancel := context.WithCancel(context.Background())
-//	defer cancel()
-//
-//	done := make(chan bool)
-//
-//	go func() {
-//		frames := in.display.Capture(ctx, 60) // TODO: framerate
-//
-//		for frame := range frames {
-//			fmt.Println(in.display.Resolution())
-//
-//			go in.processFrame(in.display, frame)
-//		}
-//
-//		cancel()
-//		done <- true
-//	}()
-//
-//	//displayConfigs, err := in.matchDisplays(in.displays)
-//	//if err != nil {
-//	//	return err
-//	//}
-//	//
-//	//in.scalers = make(map[int]draw.Scaler)
-//
-//	//for _, cfg := range displayConfigs {
-//	//	for _, seg := range cfg.Segments {
-//	//		rect := image.Rect(seg.From.X, seg.From.Y, seg.To.X, seg.To.Y)
-//	//
-//	//		// TODO: only allow cube (Dx == Dy) if segment is only 1 led
-//	//
-//	//		var width, height int
-//	//
-//	//		if rect.Dx() > rect.Dy() {
-//	//			// horizontal
-//	//			width = seg.Leds
-//	//			height = 2
-//	//		} else {
-//	//			// vertical
-//	//			width = 2
-//	//			height = seg.Leds
-//	//		}
-//	//
-//	//		in.scalers[seg.Id] = draw.BiLinear.NewScaler(width, height, cfg.Width, cfg.Height)
-//	//	}
-//	//}
-//
-//	//var wg sync.WaitGroup
-//	//wg.Add(len(displays))
-//	//
-//	//for _, d := range displays {
-//	//	//cfg := displayConfigs[d.Id()]
-//	//
-//	//	go func(d types2.Display) {
-//	//		defer wg.Done()
-//	//		frames := d.Capture(ctx, 60) // TODO: framerate
-//	//
-//	//		for frame := range frames {
-//	//			fmt.Println(d.Resolution())
-//	//
-//	//			go in.processFrame(d, frame)
-//	//		}
-//	//
-//	//		cancel()
-//	//	}(d)
-//	//}
-//	//
-//	//wg.Wait()
-//
-//	return nil
-//}
-
+// processFrame scales the captured region of a frame down to the leds of
+// each output and sends the colors to the sinks of the outputs.
 func (in *Input) processFrame(pix []byte) {
 	now := time.Now()
 
-	//src := &image.RGBA{
-	//	Pix:    pix,
-	//	Stride: d.Width() * 4,
-	//	Rect:   image.Rect(0, 0, d.Width(), d.Height()),
-	//}
-
-	//segs := make([]visualizer.Segment, len(cfg.Segments))
-
-	for _, _ = range in.outputs {
-		//rect := image.Rect(seg.From.X, seg.From.Y, seg.To.X, seg.To.Y)
-		//
-		//sub := src.SubImage(rect)
-		//
-		//var dst *image.RGBA
-		//
-		//if rect.Dx() > rect.Dy() {
-		//	// horizontal
-		//	dst = image.NewRGBA(image.Rect(0, 0, seg.Leds, 1))
-		//} else {
-		//	// vertical
-		//	dst = image.NewRGBA(image.Rect(0, 0, 1, seg.Leds))
-		//}
-
-		//v.scalers[seg.Id].Scale(dst, dst.Bounds(), sub, sub.Bounds(), draw.Over, nil)
-
-		//colors := []color.Color{}
-
-		//for i := 0; i < len(dst.Pix); i += 4 {
-		//	clr, _ := colorful.MakeColor(color.NRGBA{
-		//		R: dst.Pix[i],
-		//		G: dst.Pix[i+1],
-		//		B: dst.Pix[i+2],
-		//		A: dst.Pix[i+3],
-		//	})
-		//
-		//	colors = append(colors, clr)
-		//}
-
-		//if seg.Reverse {
-		//	reverse(colors)
-		//}
-
-		//segs[i] = visualizer.Segment{
-		//	Id:  seg.Id,
-		//	Pix: colors,
-		//}
+	in.mux.Lock()
+	d := in.display
+	region := in.region
+	outputs := make([]outputCaptureConfig, 0, len(in.outputs))
+	for _, out := range in.outputs {
+		outputs = append(outputs, out)
+	}
+	in.mux.Unlock()
 
+	bounds := image.Rect(0, 0, d.Width(), d.Height())
+	if region.Empty() {
+		region = bounds
+	} else {
+		region = region.Intersect(bounds)
 	}
 
-	//wg.Wait()
+	src := &image.NRGBA{
+		Pix:    pix,
+		Stride: d.Width() * 4,
+		Rect:   bounds,
+	}
+	sub := src.SubImage(region)
 
 	var outs = map[uuid.UUID][]types.UpdateEventOutput{}
-	for _, out := range in.outputs {
+	for _, out := range outputs {
+		dst := image.NewNRGBA(image.Rect(0, 0, out.leds, 1))
+		draw.BiLinear.Scale(dst, dst.Bounds(), sub, sub.Bounds(), draw.Src, nil)
+
 		pix := make([]color.Color, out.leds)
-		for i := 0; i < out.leds; i++ {
-			pix[i] = color.NRGBA{
-				R: uint8(i % 255),
-				G: 0,
-				B: 0,
-				A: 255,
-			}
+		for i := range pix {
+			pix[i] = dst.NRGBAAt(i, 0)
+		}
+
+		if out.reverse {
+			slices.Reverse(pix)
 		}
 
 		outs[out.sinkId] = append(outs[out.sinkId], types.UpdateEventOutput{
@@ -296,5 +175,4 @@ func (in *Input) processFrame(pix []byte) {
 		default:
 		}
 	}
-
 }
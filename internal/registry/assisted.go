@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"ledctl3/event"
+	"ledctl3/pkg/uuid"
+)
+
+// RequestAssistedSetup asks the device of the input with the given id to
+// propose a config for it. The proposed config is stored once the device
+// replies, and becomes the config of the input if it has none yet.
+func (r *Registry) RequestAssistedSetup(id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	in := r.input(id)
+	if in == nil {
+		return ErrInputNotFound
+	}
+
+	dev := r.State.Devices[r.inputDeviceId(id)]
+	if r.pending(dev) {
+		return errors.New("device pending approval")
+	}
+
+	addr, ok := r.connsAddr[dev.Id]
+	if !ok || !in.Connected {
+		return errors.New("input disconnected")
+	}
+
+	if !dev.HasFeature(event.FeatureAssistedSetup) {
+		return errors.New("device does not support assisted setup")
+	}
+
+	reqId := uuid.New()
+	return r.sendRequest(addr, reqId, event.AssistedSetup{
+		RequestId: reqId,
+		InputId:   id,
+	}, nil)
+}
+
+func (r *Registry) handleAssistedSetupConfig(addr string, e event.AssistedSetupConfig) error {
+	fmt.Printf("%s: recv AssistedSetupConfig\n", addr)
+
+	id, ok := r.conns[addr]
+	if !ok {
+		return errors.New("device disconnected")
+	}
+
+	in, ok := r.State.Devices[id].Inputs[e.InputId]
+	if !ok {
+		return errors.New("input not found")
+	}
+
+	in.AssistedConfig = e.Config
+
+	// the device applies configs per input, not per mapping
+	if in.Config != nil {
+		return nil
+	}
+
+	config, fields, err := validateConfig(in, e.Config)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+
+	in.Config = config
+
+	r.pushInputConfig(in)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"ledctl3/event"
+	"ledctl3/pkg/uuid"
+)
+
+// SetInputConfig changes the config of the input with the given id. The
+// config is validated against the schema of the input, see ValidationError,
+// and stored with the schema defaults filled in. If the device of the input
+// is connected, it is asked to apply the config right away; otherwise the
+// config is sent once the input connects.
+func (r *Registry) SetInputConfig(id uuid.UUID, config map[string]any) (map[string]any, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	in := r.input(id)
+	if in == nil {
+		return nil, ErrInputNotFound
+	}
+
+	config, fields, err := validateConfig(in, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	in.Config = config
+
+	err = r.sh.SetState(*r.State)
+	if err != nil {
+		return nil, err
+	}
+
+	r.pushInputConfig(in)
+
+	return config, nil
+}
+
+// pushInputConfig sends the stored config of an input to its device, if the
+// input is connected and its device is allowed to exchange data and supports
+// changing input configs.
+func (r *Registry) pushInputConfig(in *Input) {
+	if in.Config == nil || !in.Connected {
+		return
+	}
+
+	dev, ok := r.State.Devices[r.inputDeviceId(in.Id)]
+	if !ok || r.pending(dev) || !dev.HasFeature(event.FeatureInputConfig) {
+		return
+	}
+
+	addr, ok := r.connsAddr[dev.Id]
+	if !ok {
+		return
+	}
+
+	reqId := uuid.New()
+	err := r.sendRequest(addr, reqId, event.SetInputConfig{
+		RequestId: reqId,
+		InputId:   in.Id,
+		Config:    in.Config,
+	}, nil)
+	if err != nil {
+		fmt.Println("error sending SetInputConfig:", err)
+	}
+}
+
+// handleInputConfigApplied stores the config a device reports in effect for
+// one of its inputs.
+func (r *Registry) handleInputConfigApplied(addr string, e event.InputConfigApplied) error {
+	fmt.Printf("%s: recv InputConfigApplied\n", addr)
+
+	id, ok := r.conns[addr]
+	if !ok {
+		return errors.New("device disconnected")
+	}
+
+	in, ok := r.State.Devices[id].Inputs[e.InputId]
+	if !ok {
+		return errors.New("input not found")
+	}
+
+	in.Config = e.Config
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+
+	"ledctl3/event"
+)
+
+// SetDataPlane enables the UDP data plane for devices that support it. Port
+// is the local UDP port devices should send realtime data to, and write
+// sends an event to the data address of a device.
+func (r *Registry) SetDataPlane(port int, write func(addr string, e event.Event) error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.dataPort = port
+	r.dataWrite = write
+
+	if !slices.Contains(r.features, event.FeatureUDPData) {
+		r.features = append(r.features, event.FeatureUDPData)
+	}
+}
+
+// openDataChannel associates the data address of a device with its
+// connection, and tells the device where to send realtime data to.
+func (r *Registry) openDataChannel(addr string, port int) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	dataAddr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	r.dataAddrs[addr] = dataAddr
+	r.dataConns[dataAddr] = addr
+
+	return r.send(addr, event.DataChannel{
+		Port: r.dataPort,
+	})
+}
+
+func (r *Registry) closeDataChannel(addr string) {
+	dataAddr, ok := r.dataAddrs[addr]
+	if !ok {
+		return
+	}
+
+	delete(r.dataConns, dataAddr)
+	delete(r.dataAddrs, addr)
+}
+
+// ProcessData handles an event received over the data plane. The data plane
+// is not authenticated, so only Data events sent from the data address of a
+// connected device are accepted; anything else is dropped.
+func (r *Registry) ProcessData(addr string, e event.Event) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	data, ok := e.(event.Data)
+	if !ok {
+		return fmt.Errorf("unexpected %T on data plane", e)
+	}
+
+	connAddr, ok := r.dataConns[addr]
+	if !ok {
+		return errors.New("unknown data peer")
+	}
+
+	// data received over the data plane is attributed to the connection of
+	// the device that sent it
+	return r.handleData(connAddr, data)
+}
@@ -2,15 +2,25 @@ package registry
 
 import (
 	"fmt"
+	"slices"
 
+	"ledctl3/event"
 	"ledctl3/pkg/uuid"
 )
 
+// Device is a device known to the registry. While pairing is required,
+// Pending is set until the device is adopted, and TokenHash holds the hash of
+// the credential the device was issued.
 type Device struct {
 	Id        uuid.UUID             `json:"id"`
+	Version   string                `json:"version"`
 	Inputs    map[uuid.UUID]*Input  `json:"inputs"`
 	Outputs   map[uuid.UUID]*Output `json:"outputs"`
+	Pending   bool                  `json:"pending"`
+	TokenHash string                `json:"token_hash,omitempty"`
 	Connected bool                  `json:"-"`
+	Codecs    []string              `json:"-"`
+	Features  []event.Feature       `json:"-"`
 }
 
 func NewDevice(id uuid.UUID, connected bool) *Device {
@@ -32,6 +42,8 @@ func (d *Device) Disconnect() {
 	}
 
 	d.Connected = false
+	d.Codecs = nil
+	d.Features = nil
 	fmt.Println("device disconnected:", d.Id)
 }
 
@@ -62,6 +74,9 @@ func (d *Device) ConnectInput(id uuid.UUID, schema, config map[string]any) {
 		d.Inputs[in.Id] = in
 	}
 
+	// the schema may change with the software of the device
+	in.Schema = schema
+
 	in.Connect()
 }
 
@@ -85,6 +100,13 @@ func (d *Device) DisconnectOutput(id uuid.UUID) {
 	out.Disconnect()
 }
 
-func (d *Device) Connect() {
+func (d *Device) Connect(version string, codecs []string, features []event.Feature) {
+	d.Version = version
+	d.Codecs = codecs
+	d.Features = features
 	d.Connected = true
 }
+
+func (d *Device) HasFeature(f event.Feature) bool {
+	return slices.Contains(d.Features, f)
+}
@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"sort"
+	"time"
+
+	"ledctl3/pkg/uuid"
+)
+
+// DefaultDiscoveredTTL is how long a discovered device is listed after it
+// was last seen on the network.
+const DefaultDiscoveredTTL = 3 * time.Minute
+
+// DiscoveredDevice is a device that advertises itself on the network.
+type DiscoveredDevice struct {
+	Id       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Addr     string    `json:"addr"`
+	Inputs   int       `json:"inputs"`
+	Outputs  int       `json:"outputs"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// SetDiscoveredTTL sets how long a discovered device is listed after it was
+// last seen. Devices must be reported again within the TTL to stay listed.
+func (r *Registry) SetDiscoveredTTL(ttl time.Duration) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.foundTTL = ttl
+}
+
+// DeviceDiscovered records a device advertised on the network. Discovered
+// devices are transient and are not persisted with the registry state.
+func (r *Registry) DeviceDiscovered(dev DiscoveredDevice) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if dev.LastSeen.IsZero() {
+		dev.LastSeen = time.Now()
+	}
+
+	r.found[dev.Id] = dev
+
+	r.pruneDiscovered()
+}
+
+// Discovered returns the devices that were discovered on the network but
+// are not connected to the registry, e.g. sinks that failed to connect.
+func (r *Registry) Discovered() []DiscoveredDevice {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.pruneDiscovered()
+
+	devs := []DiscoveredDevice{}
+	for id, dev := range r.found {
+		if _, ok := r.connsAddr[id]; ok {
+			continue
+		}
+
+		devs = append(devs, dev)
+	}
+
+	sort.Slice(devs, func(i, j int) bool {
+		return devs[i].Id < devs[j].Id
+	})
+
+	return devs
+}
+
+// pruneDiscovered forgets the devices that were not seen within the TTL,
+// e.g. ones that were switched off.
+func (r *Registry) pruneDiscovered() {
+	for id, dev := range r.found {
+		if time.Since(dev.LastSeen) > r.foundTTL {
+			delete(r.found, id)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package registry
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
 
 	"ledctl3/event"
+	"ledctl3/pkg/uuid"
 )
 
 func (r *Registry) ProcessEvent(addr string, e event.Event) error {
@@ -29,6 +32,14 @@ func (r *Registry) ProcessEvent(addr string, e event.Event) error {
 		err = r.handleOutputDisconnected(addr, e)
 	case event.Data:
 		r.handleData(addr, e)
+	case event.AssistedSetupConfig:
+		err = r.handleAssistedSetupConfig(addr, e)
+	case event.InputConfigApplied:
+		err = r.handleInputConfigApplied(addr, e)
+	case event.Ack:
+		err = r.handleAck(addr, e)
+	case event.Error:
+		err = r.handleError(addr, e)
 	default:
 		fmt.Printf("unknown event %#v\n", e)
 	}
@@ -63,30 +74,107 @@ func (r *Registry) handleConnect(addr string, e event.Connect) error {
 		return errors.New("device already connected")
 	}
 
+	err := event.CompatibleVersion(e.Version)
+	if err != nil {
+		fmt.Println("device rejected:", e.Id, err)
+
+		r.reject(addr, event.ErrorCodeIncompatibleVersion, err)
+
+		return err
+	}
+
+	// devices that do not list their codecs are taken to speak the one they
+	// connected with
+	codecs := event.NegotiateCodecs(r.codecs, e.Codecs)
+	if len(r.codecs) > 0 && len(e.Codecs) > 0 && len(codecs) == 0 {
+		err := errors.New("no common codec")
+		fmt.Println("device rejected:", e.Id, err)
+
+		r.reject(addr, event.ErrorCodeIncompatibleCodec, err)
+
+		return err
+	}
+
+	dev, ok := r.State.Devices[e.Id]
+	if ok {
+		fmt.Println("device connected:", e.Id)
+	} else {
+		dev = NewDevice(e.Id, false)
+		r.State.Devices[e.Id] = dev
+
+		fmt.Println("device added:", e.Id)
+	}
+
+	if r.pairing {
+		err = r.pair(addr, dev, e.Token)
+		if err != nil {
+			fmt.Println("device rejected:", e.Id, err)
+
+			r.reject(addr, event.ErrorCodeUnauthorized, err)
+
+			return err
+		}
+	}
+
+	// the device may come back under a new address before its old
+	// connection times out, which must not take the new session down
+	if oldAddr, ok := r.connsAddr[e.Id]; ok {
+		r.retireConn(oldAddr, dev, "device reconnected")
+	}
+
 	r.conns[addr] = e.Id
 	r.connsAddr[e.Id] = addr
 
-	if dev, ok := r.State.Devices[e.Id]; ok {
-		dev.Connect()
-		r.State.Devices[e.Id] = dev
+	features := event.NegotiateFeatures(r.features, e.Features)
 
-		fmt.Println("device connected:", e.Id)
+	dev.Connect(e.Version, e.Codecs, features)
 
-		return nil
+	if r.onConnect != nil {
+		r.onConnect(addr, e.Id)
 	}
 
-	r.State.Devices[e.Id] = NewDevice(e.Id, true)
+	fmt.Printf("%s: send ConnectAck\n", addr)
+
+	err = r.write(addr, event.ConnectAck{
+		Version:  event.ProtocolVersion,
+		Codecs:   codecs,
+		Features: features,
+	})
+	if err != nil {
+		fmt.Println("error sending event:", err)
+	}
 
-	fmt.Println("device added:", e.Id)
+	r.reconcile()
+
+	if dev.HasFeature(event.FeatureUDPData) && e.DataPort > 0 {
+		return r.openDataChannel(addr, e.DataPort)
+	}
 
 	return nil
 }
 
+// reject tells a device why its connection was refused and closes it, so
+// that the device moves on instead of waiting on a registry that ignores it.
+func (r *Registry) reject(addr string, code event.ErrorCode, reason error) {
+	err := r.write(addr, event.Error{
+		Code:   code,
+		Reason: reason.Error(),
+	})
+	if err != nil {
+		fmt.Println("error sending event:", err)
+	}
+
+	err = r.close(addr)
+	if err != nil {
+		fmt.Println("error closing connection:", err)
+	}
+}
+
 func (r *Registry) handleDisconnect(addr string, _ event.Disconnect) error {
 	fmt.Printf("%s: recv Disconnect\n", addr)
 
 	id, ok := r.conns[addr]
-	if !ok {
+	if !ok || r.connsAddr[id] != addr {
 		return errors.New("device already disconnected")
 	}
 
@@ -94,12 +182,27 @@ func (r *Registry) handleDisconnect(addr string, _ event.Disconnect) error {
 
 	dev.Disconnect()
 
-	delete(r.conns, addr)
+	r.retireConn(addr, dev, "device disconnected")
 	delete(r.connsAddr, id)
 
+	r.reconcile()
+
 	return nil
 }
 
+// retireConn forgets the connection of a device at addr.
+func (r *Registry) retireConn(addr string, dev *Device, reason string) {
+	r.closeDataChannel(addr)
+	r.failRequests(addr, reason)
+
+	delete(r.conns, addr)
+
+	// the inputs report what they are feeding when the device reconnects
+	for inputId := range dev.Inputs {
+		delete(r.running, inputId)
+	}
+}
+
 func (r *Registry) handleInputConnected(addr string, e event.InputConnected) error {
 	fmt.Printf("%s: recv InputConnected\n", addr)
 
@@ -112,32 +215,21 @@ func (r *Registry) handleInputConnected(addr string, e event.InputConnected) err
 
 	dev.ConnectInput(e.Id, e.Schema, e.Config)
 
-	cfgs := r.activeInputConfigs(e.Id)
-	if len(cfgs) == 0 {
-		return nil
+	// the device does not keep the config set by the registry across restarts
+	if in := dev.Inputs[e.Id]; !reflect.DeepEqual(in.Config, e.Config) {
+		r.pushInputConfig(in)
 	}
 
-	var evtOutCfgs []event.SetInputActiveOutput
-	for _, cfg := range cfgs {
-		sink := r.State.Devices[r.outputDeviceId(cfg.OutputId)]
+	r.setRunning(e.Id, e.Outputs)
 
-		evtOutCfgs = append(evtOutCfgs, event.SetInputActiveOutput{
-			Id:     cfg.OutputId,
-			SinkId: sink.Id,
-			Leds:   sink.Outputs[cfg.OutputId].Leds,
-			Config: cfg.Config,
-		})
+	var ios []ioKey
+	for _, out := range e.Outputs {
+		ios = append(ios, ioKey{inputId: e.Id, outputId: out.Id})
 	}
 
-	err := r.send(addr, event.SetInputActive{
-		Id:      e.Id,
-		Outputs: evtOutCfgs,
-	})
-	if err != nil {
-		return err
-	}
+	r.setIOStatus(ios, IOStateActive, "")
 
-	fmt.Println("sent SetInputActive to", addr)
+	r.reconcile()
 
 	return nil
 }
@@ -154,6 +246,10 @@ func (r *Registry) handleInputDisconnected(addr string, e event.InputDisconnecte
 
 	dev.DisconnectInput(e.Id)
 
+	delete(r.running, e.Id)
+
+	r.reconcile()
+
 	return nil
 }
 
@@ -169,6 +265,8 @@ func (r *Registry) handleOutputConnected(addr string, e event.OutputConnected) e
 
 	dev.ConnectOutput(e.Id, e.Leds, e.Schema, e.Config)
 
+	r.reconcile()
+
 	return nil
 }
 
@@ -184,20 +282,47 @@ func (r *Registry) handleOutputDisconnected(addr string, e event.OutputDisconnec
 
 	dev.DisconnectOutput(e.Id)
 
+	r.reconcile()
+
 	return nil
 }
 
 func (r *Registry) handleData(addr string, e event.Data) error {
-	_, ok := r.conns[addr]
+	srcId, ok := r.conns[addr]
 	if !ok {
 		return errors.New("device disconnected")
 	}
 
+	srcDev := r.State.Devices[srcId]
+
+	if r.pending(srcDev) {
+		return errors.New("device pending approval")
+	}
+
+	// frames that were in flight when their mapping was released must not
+	// light up the outputs again once they are blanked
+	outputs := make([]event.DataOutput, 0, len(e.Outputs))
+	for _, out := range e.Outputs {
+		if r.feeding(srcDev, out.Id) {
+			outputs = append(outputs, out)
+		}
+	}
+
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	e.Outputs = outputs
+
 	sinkDev := r.State.Devices[e.SinkId]
 	if sinkDev == nil {
 		return errors.New("unknown sink device")
 	}
 
+	if r.pending(sinkDev) {
+		return errors.New("sink device pending approval")
+	}
+
 	sinkAddr, ok := r.connsAddr[e.SinkId]
 	if !ok {
 		return errors.New("sink device disconnected")
@@ -205,6 +330,10 @@ func (r *Registry) handleData(addr string, e event.Data) error {
 
 	fmt.Print(".")
 
+	if dataAddr, ok := r.dataAddrs[sinkAddr]; ok {
+		return r.dataWrite(dataAddr, e)
+	}
+
 	err := r.send(sinkAddr, e)
 	if err != nil {
 		return err
@@ -212,3 +341,17 @@ func (r *Registry) handleData(addr string, e event.Data) error {
 
 	return nil
 }
+
+// feeding reports whether one of the inputs of dev is feeding the output
+// with the given id.
+func (r *Registry) feeding(dev *Device, outputId uuid.UUID) bool {
+	for inputId := range dev.Inputs {
+		if slices.ContainsFunc(r.running[inputId], func(out event.SetInputActiveOutput) bool {
+			return out.Id == outputId
+		}) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -11,6 +11,10 @@ type Input struct {
 	Schema    map[string]any `json:"schema"`
 	Config    map[string]any `json:"config"`
 	Connected bool           `json:"-"`
+
+	// AssistedConfig is the config proposed by the device of the input, see
+	// RequestAssistedSetup.
+	AssistedConfig map[string]any `json:"assisted_config,omitempty"`
 }
 
 func NewInput(id uuid.UUID, schema, config map[string]any, connected bool) *Input {
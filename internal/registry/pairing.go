@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"ledctl3/event"
+	"ledctl3/pkg/uuid"
+)
+
+// SetPairingRequired controls whether devices must be paired before they
+// are allowed to send or receive data. Devices that connect for the first
+// time while pairing is required are issued a credential and stay pending
+// until they are adopted.
+func (r *Registry) SetPairingRequired(required bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.pairing = required
+}
+
+// AdoptDevice approves a device that is pending approval. If the device is
+// connected, its inputs and outputs join any active profiles right away and
+// its inputs are sent their stored config.
+func (r *Registry) AdoptDevice(id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	dev, ok := r.State.Devices[id]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+
+	if !dev.Pending {
+		return errors.New("device not pending approval")
+	}
+
+	dev.Pending = false
+
+	err := r.sh.SetState(*r.State)
+	if err != nil {
+		fmt.Println("error writing State", err)
+	}
+
+	fmt.Println("device adopted:", id)
+
+	for _, in := range dev.Inputs {
+		r.pushInputConfig(in)
+	}
+
+	r.reconcile()
+
+	return nil
+}
+
+// ResetDevice forgets the credential of a device, e.g. one that was lost or
+// leaked. The device is disconnected, and is issued a new credential and
+// held pending approval the next time it connects.
+func (r *Registry) ResetDevice(id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	dev, ok := r.State.Devices[id]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+
+	dev.TokenHash = ""
+	dev.Pending = true
+
+	err := r.sh.SetState(*r.State)
+	if err != nil {
+		fmt.Println("error writing State", err)
+	}
+
+	fmt.Println("device reset:", id)
+
+	// the device must pair again before it exchanges data; its mappings are
+	// released once the connection is gone
+	if addr, ok := r.connsAddr[id]; ok {
+		err = r.close(addr)
+		if err != nil {
+			fmt.Println("error closing connection:", err)
+		}
+	}
+
+	return nil
+}
+
+// pending reports whether the device is not allowed to exchange data yet.
+func (r *Registry) pending(dev *Device) bool {
+	return r.pairing && dev.Pending
+}
+
+// pair authenticates a connecting device. A credential is issued once, on the
+// first connection of a device, and every later connection must present it,
+// whether the device was adopted or is still pending. This way a connection
+// impersonating a pending device cannot take over its credential.
+func (r *Registry) pair(addr string, dev *Device, token string) error {
+	if dev.TokenHash != "" {
+		if !dev.verifyToken(token) {
+			return errors.New("invalid credential")
+		}
+
+		return nil
+	}
+
+	dev.Pending = true
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+
+	token = hex.EncodeToString(b)
+	dev.TokenHash = hashToken(token)
+
+	fmt.Println("device pending approval:", dev.Id)
+
+	return r.write(addr, event.Paired{
+		Token: token,
+	})
+}
+
+func (d *Device) verifyToken(token string) bool {
+	if d.TokenHash == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(d.TokenHash)) == 1
+}
+
+// hashToken returns the hash of a credential, so that the registry state
+// does not hold the credentials themselves.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
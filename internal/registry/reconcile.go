@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"ledctl3/event"
+	"ledctl3/pkg/uuid"
+)
+
+// desiredInput holds the outputs an input should be feeding according to
+// the active profiles.
+type desiredInput struct {
+	id      uuid.UUID
+	outputs []event.SetInputActiveOutput
+}
+
+// activation is a SetInputActive request that reconcile is about to send.
+type activation struct {
+	addr    string
+	id      uuid.UUID
+	outputs []event.SetInputActiveOutput
+}
+
+// reconcile converges the connected source devices to the mappings of the
+// active profiles. The outputs each input is feeding are known from what
+// its device reported when the input connected, and from the requests sent
+// to it since. Inputs that feed a subset of their desired outputs are sent
+// a SetSourceIdle for the rest, every other difference is resolved with a
+// SetInputActive carrying all of the desired outputs.
+//
+// Sources are stopped first. The outputs of the released mappings are then
+// blanked, see releaseIO, and only then are inputs started. Frames the
+// stopped sources still send are dropped by handleData, so that they do not
+// light the blanked outputs up again.
+func (r *Registry) reconcile(released ...IOConfig) {
+	desired := r.desiredInputs()
+
+	idle := map[string][]event.SetSourceIdleInput{}
+	var idleAddrs []string
+	var activations []activation
+
+	inputIds := make([]uuid.UUID, 0, len(desired))
+	for _, in := range desired {
+		inputIds = append(inputIds, in.id)
+	}
+
+	var runningIds []uuid.UUID
+	for id := range r.running {
+		if !slices.Contains(inputIds, id) {
+			runningIds = append(runningIds, id)
+		}
+	}
+
+	sort.Slice(runningIds, func(i, j int) bool {
+		return runningIds[i] < runningIds[j]
+	})
+
+	for _, id := range append(inputIds, runningIds...) {
+		var outputs []event.SetInputActiveOutput
+		if i := slices.IndexFunc(desired, func(in desiredInput) bool { return in.id == id }); i != -1 {
+			outputs = desired[i].outputs
+		}
+
+		running := r.running[id]
+		if reflect.DeepEqual(outputs, running) || (len(outputs) == 0 && len(running) == 0) {
+			continue
+		}
+
+		addr, ok := r.connsAddr[r.inputDeviceId(id)]
+		if !ok {
+			continue
+		}
+
+		if released, ok := releasedOutputs(running, outputs); ok {
+			if _, ok := idle[addr]; !ok {
+				idleAddrs = append(idleAddrs, addr)
+			}
+
+			idle[addr] = append(idle[addr], event.SetSourceIdleInput{
+				InputId:   id,
+				OutputIds: released,
+			})
+
+			r.setRunning(id, outputs)
+			continue
+		}
+
+		activations = append(activations, activation{addr: addr, id: id, outputs: outputs})
+	}
+
+	for _, addr := range idleAddrs {
+		reqId := uuid.New()
+		err := r.sendRequest(addr, reqId, event.SetSourceIdle{
+			RequestId: reqId,
+			Inputs:    idle[addr],
+		}, nil)
+		if err != nil {
+			fmt.Println("error sending event:", err)
+			continue
+		}
+
+		fmt.Println("sent SetSourceIdle to", addr)
+	}
+
+	r.releaseIO(released)
+
+	for _, a := range activations {
+		var ios []ioKey
+		for _, out := range a.outputs {
+			ios = append(ios, ioKey{inputId: a.id, outputId: out.Id})
+		}
+
+		reqId := uuid.New()
+		err := r.sendRequest(a.addr, reqId, event.SetInputActive{
+			RequestId: reqId,
+			Id:        a.id,
+			Outputs:   a.outputs,
+		}, ios)
+		if err != nil {
+			fmt.Println("error sending event:", err)
+			continue
+		}
+
+		fmt.Println("sent SetInputActive to", a.addr)
+
+		r.setRunning(a.id, a.outputs)
+	}
+}
+
+func (r *Registry) setRunning(id uuid.UUID, outputs []event.SetInputActiveOutput) {
+	if len(outputs) == 0 {
+		delete(r.running, id)
+		return
+	}
+
+	r.running[id] = outputs
+}
+
+// desiredInputs returns the connected inputs that should be feeding
+// outputs, in the order they appear in the active profiles. Mappings that
+// cannot be applied are marked as failed.
+func (r *Registry) desiredInputs() []desiredInput {
+	var desired []desiredInput
+
+	for _, profId := range r.State.ActiveProfiles {
+		for _, io := range r.State.Profiles[profId].IO {
+			key := ioKey{inputId: io.InputId, outputId: io.OutputId}
+
+			src := r.State.Devices[r.inputDeviceId(io.InputId)]
+			if src == nil {
+				r.setIOStatus([]ioKey{key}, IOStateFailed, "input not found")
+				continue
+			}
+
+			sink := r.State.Devices[r.outputDeviceId(io.OutputId)]
+			if sink == nil {
+				r.setIOStatus([]ioKey{key}, IOStateFailed, "output not found")
+				continue
+			}
+
+			if r.pending(src) || r.pending(sink) {
+				r.setIOStatus([]ioKey{key}, IOStateFailed, "device pending approval")
+				continue
+			}
+
+			if !src.Connected || !src.Inputs[io.InputId].Connected {
+				r.setIOStatus([]ioKey{key}, IOStateFailed, "input disconnected")
+				continue
+			}
+
+			out := sink.Outputs[io.OutputId]
+			if !sink.Connected || !out.Connected {
+				r.setIOStatus([]ioKey{key}, IOStateFailed, "output disconnected")
+				continue
+			}
+
+			i := slices.IndexFunc(desired, func(in desiredInput) bool { return in.id == io.InputId })
+			if i == -1 {
+				desired = append(desired, desiredInput{id: io.InputId})
+				i = len(desired) - 1
+			}
+
+			desired[i].outputs = append(desired[i].outputs, event.SetInputActiveOutput{
+				Id:     io.OutputId,
+				SinkId: sink.Id,
+				Leds:   out.Leds,
+				Config: io.Config,
+			})
+		}
+	}
+
+	return desired
+}
+
+// releasedOutputs returns the outputs of running that are not in desired, if
+// desired only lacks outputs that are running and leaves the rest unchanged.
+func releasedOutputs(running, desired []event.SetInputActiveOutput) ([]uuid.UUID, bool) {
+	for _, out := range desired {
+		if !slices.ContainsFunc(running, func(r event.SetInputActiveOutput) bool {
+			return reflect.DeepEqual(r, out)
+		}) {
+			return nil, false
+		}
+	}
+
+	var released []uuid.UUID
+	for _, out := range running {
+		if !slices.ContainsFunc(desired, func(d event.SetInputActiveOutput) bool {
+			return d.Id == out.Id
+		}) {
+			released = append(released, out.Id)
+		}
+	}
+
+	return released, len(released) > 0
+}
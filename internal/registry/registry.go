@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"slices"
 	"sync"
+	"time"
 
 	"ledctl3/event"
+	"ledctl3/pkg/transport"
 	"ledctl3/pkg/uuid"
 )
 
@@ -26,16 +28,42 @@ type State struct {
 	ActiveProfiles []uuid.UUID           `json:"activeProfiles"`
 }
 
+// features lists the optional protocol features supported by the registry.
+var features = []event.Feature{
+	event.FeatureInputConfig,
+	event.FeatureAssistedSetup,
+}
+
 type Registry struct {
-	mux       sync.Mutex
-	conns     map[string]uuid.UUID
-	connsAddr map[uuid.UUID]string
-	write     func(addr string, e event.Event) error
-	State     *State
-	sh        StateHolder
+	mux        sync.Mutex
+	conns      map[string]uuid.UUID
+	connsAddr  map[uuid.UUID]string
+	write      func(addr string, e event.Event) error
+	close      func(addr string) error
+	features   []event.Feature
+	codecs     []string
+	dataPort   int
+	dataWrite  func(addr string, e event.Event) error
+	dataAddrs  map[string]string
+	dataConns  map[string]string
+	requests   map[uuid.UUID]request
+	reqTimeout time.Duration
+	ioStatus   map[ioKey]IOStatus
+	pairing    bool
+	found      map[uuid.UUID]DiscoveredDevice
+	foundTTL   time.Duration
+	State      *State
+	sh         StateHolder
+	onConnect  func(addr string, id uuid.UUID)
+
+	// running holds the outputs each connected input is feeding, as far as
+	// the registry knows, see reconcile.
+	running map[uuid.UUID][]event.SetInputActiveOutput
 }
 
-func New(sh StateHolder, write func(addr string, e event.Event) error) *Registry {
+// New creates a registry that talks to devices over the given transport. It
+// takes over the message and disconnect handlers of the transport.
+func New(sh StateHolder, t transport.Transport[event.Event]) *Registry {
 	state, err := sh.GetState()
 	if err == nil {
 		//fmt.Println("Loaded State", State)
@@ -54,13 +82,52 @@ func New(sh StateHolder, write func(addr string, e event.Event) error) *Registry
 
 	//fmt.Println("Starting with State", fmt.Sprintf("%#v", State))
 
-	return &Registry{
-		conns:     make(map[string]uuid.UUID),
-		connsAddr: make(map[uuid.UUID]string),
-		State:     &state,
-		write:     write,
-		sh:        sh,
+	r := &Registry{
+		conns:      make(map[string]uuid.UUID),
+		connsAddr:  make(map[uuid.UUID]string),
+		State:      &state,
+		write:      t.Write,
+		close:      t.Close,
+		features:   slices.Clone(features),
+		dataAddrs:  make(map[string]string),
+		dataConns:  make(map[string]string),
+		requests:   make(map[uuid.UUID]request),
+		reqTimeout: DefaultRequestTimeout,
+		ioStatus:   make(map[ioKey]IOStatus),
+		found:      make(map[uuid.UUID]DiscoveredDevice),
+		foundTTL:   DefaultDiscoveredTTL,
+		sh:         sh,
+		running:    make(map[uuid.UUID][]event.SetInputActiveOutput),
 	}
+
+	t.SetMessageHandler(func(addr string, e event.Event) {
+		_ = r.ProcessEvent(addr, e)
+	})
+
+	t.SetDisconnectHandler(func(addr string) {
+		_ = r.ProcessEvent(addr, event.Disconnect{})
+	})
+
+	return r
+}
+
+// SetCodecs sets the names of the codecs the registry accepts connections
+// with. The codecs a device shares with the registry are reported back to it
+// when it connects.
+func (r *Registry) SetCodecs(codecs ...string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.codecs = codecs
+}
+
+// SetConnectHandler sets a handler that is called with the address and id of
+// every device that connects successfully.
+func (r *Registry) SetConnectHandler(h func(addr string, id uuid.UUID)) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.onConnect = h
 }
 
 type Profile struct {
@@ -101,13 +168,31 @@ type IOConfig struct {
 //	InputConfigId uuid.UUID `json:"input_config_id"`
 //}
 
-var ErrEmptyIO = errors.New("empty io")
+var (
+	ErrEmptyIO         = errors.New("empty io")
+	ErrEmptyName       = errors.New("empty name")
+	ErrProfileNotFound = errors.New("profile not found")
+	ErrDeviceNotFound  = errors.New("device not found")
+	ErrInputNotFound   = errors.New("input not found")
+)
 
+// CreateProfile stores a new profile. Mappings without a config use the
+// config proposed by assisted setup of their input, if any. The config of
+// each mapping is checked against the schema of its input, see
+// ValidationError, and the schema defaults are filled in.
 func (r *Registry) CreateProfile(name string, io []IOConfig) (Profile, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
 	if len(io) == 0 {
 		return Profile{}, ErrEmptyIO
 	}
 
+	io, err := r.validateIO(io)
+	if err != nil {
+		return Profile{}, err
+	}
+
 	prof := Profile{
 		Id:   uuid.New(),
 		Name: name,
@@ -116,7 +201,7 @@ func (r *Registry) CreateProfile(name string, io []IOConfig) (Profile, error) {
 
 	r.State.Profiles[prof.Id] = prof
 
-	err := r.sh.SetState(*r.State)
+	err = r.sh.SetState(*r.State)
 	if err != nil {
 		return Profile{}, err
 	}
@@ -124,14 +209,21 @@ func (r *Registry) CreateProfile(name string, io []IOConfig) (Profile, error) {
 	return prof, nil
 }
 
-func (r *Registry) EnableProfile(id uuid.UUID) error {
+// EnableProfile activates the profile with the given id and asks the source
+// devices to start feeding its outputs. The returned status reports which
+// mappings could not be requested; the rest stay pending until their source
+// device acknowledges them, see ProfileStatus.
+func (r *Registry) EnableProfile(id uuid.UUID) ([]IOStatus, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
 	prof, ok := r.State.Profiles[id]
 	if !ok {
-		return errors.New("profile not found")
+		return nil, ErrProfileNotFound
 	}
 
 	if slices.Contains(r.State.ActiveProfiles, id) {
-		return errors.New("profile already enabled")
+		return nil, errors.New("profile already enabled")
 	}
 
 	activeOutputIds := r.activeOutputs()
@@ -142,7 +234,7 @@ func (r *Registry) EnableProfile(id uuid.UUID) error {
 	// modifying hue/sat and another modifying brightness.
 	for _, io := range prof.IO {
 		if slices.Contains(activeOutputIds, io.OutputId) {
-			return errors.New("output already in use")
+			return nil, errors.New("output already in use")
 		}
 	}
 
@@ -153,29 +245,233 @@ func (r *Registry) EnableProfile(id uuid.UUID) error {
 		fmt.Println("error writing State", err)
 	}
 
-	for _, io := range prof.IO {
-		srcDev := r.State.Devices[r.inputDeviceId(io.InputId)]
-		sinkDev := r.State.Devices[r.outputDeviceId(io.OutputId)]
-
-		err = r.send(r.connsAddr[srcDev.Id], event.SetInputActive{
-			Id: io.InputId,
-			Outputs: []event.SetInputActiveOutput{
-				{
-					Id:     io.OutputId,
-					SinkId: sinkDev.Id,
-					Leds:   sinkDev.Outputs[io.OutputId].Leds,
-					Config: io.Config,
-				},
-			},
+	r.reconcile()
+
+	fmt.Println("profile enabled:", id)
+	return r.profileStatus(prof), nil
+}
+
+// DisableProfile deactivates the profile with the given id. Source devices
+// are asked to stop feeding its outputs, stopping inputs that are left
+// without outputs, and sink devices are asked to blank them.
+func (r *Registry) DisableProfile(id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	prof, ok := r.State.Profiles[id]
+	if !ok {
+		return ErrProfileNotFound
+	}
+
+	if !r.profileActive(id) {
+		return errors.New("profile not enabled")
+	}
+
+	r.deactivate(prof)
+
+	err := r.sh.SetState(*r.State)
+	if err != nil {
+		fmt.Println("error writing State", err)
+	}
+
+	fmt.Println("profile disabled:", id)
+	return nil
+}
+
+// deactivate removes an active profile from the active profiles and
+// releases its mappings.
+func (r *Registry) deactivate(prof Profile) {
+	r.State.ActiveProfiles = slices.DeleteFunc(r.State.ActiveProfiles, func(id uuid.UUID) bool {
+		return id == prof.Id
+	})
+
+	r.reconcile(prof.IO...)
+}
+
+// UpdateProfile replaces the name and mappings of the profile with the given
+// id. An empty name keeps the current name. If the profile is active, only
+// the inputs and outputs whose mappings changed are reconfigured, see
+// reconcile. The configs are validated as in CreateProfile.
+func (r *Registry) UpdateProfile(id uuid.UUID, name string, io []IOConfig) (Profile, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if len(io) == 0 {
+		return Profile{}, ErrEmptyIO
+	}
+
+	prof, ok := r.State.Profiles[id]
+	if !ok {
+		return Profile{}, ErrProfileNotFound
+	}
+
+	io, err := r.validateIO(io)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	active := r.profileActive(id)
+
+	if active {
+		var otherOutputIds []uuid.UUID
+		for _, profId := range r.State.ActiveProfiles {
+			if profId == id {
+				continue
+			}
+
+			for _, io := range r.State.Profiles[profId].IO {
+				otherOutputIds = append(otherOutputIds, io.OutputId)
+			}
+		}
+
+		for _, io := range io {
+			if slices.Contains(otherOutputIds, io.OutputId) {
+				return Profile{}, errors.New("output already in use")
+			}
+		}
+	}
+
+	removed := removedIO(prof.IO, io)
+
+	updated := prof
+	if name != "" {
+		updated.Name = name
+	}
+
+	updated.IO = io
+	r.State.Profiles[id] = updated
+
+	err = r.sh.SetState(*r.State)
+	if err != nil {
+		// keep the running state in line with the persisted one
+		r.State.Profiles[id] = prof
+		return Profile{}, err
+	}
+
+	if !active {
+		return updated, nil
+	}
+
+	r.reconcile(removed...)
+
+	fmt.Println("profile updated:", id)
+	return updated, nil
+}
+
+// removedIO returns the mappings of prev that are not in next.
+func removedIO(prev, next []IOConfig) []IOConfig {
+	var removed []IOConfig
+	for _, p := range prev {
+		found := slices.ContainsFunc(next, func(n IOConfig) bool {
+			return n.InputId == p.InputId && n.OutputId == p.OutputId
 		})
+		if !found {
+			removed = append(removed, p)
+		}
+	}
+
+	return removed
+}
+
+// RenameProfile changes the name of the profile with the given id.
+func (r *Registry) RenameProfile(id uuid.UUID, name string) (Profile, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if name == "" {
+		return Profile{}, ErrEmptyName
+	}
+
+	prof, ok := r.State.Profiles[id]
+	if !ok {
+		return Profile{}, ErrProfileNotFound
+	}
+
+	renamed := prof
+	renamed.Name = name
+	r.State.Profiles[id] = renamed
+
+	err := r.sh.SetState(*r.State)
+	if err != nil {
+		r.State.Profiles[id] = prof
+		return Profile{}, err
+	}
+
+	return renamed, nil
+}
+
+// DeleteProfile deletes the profile with the given id, disabling it first if
+// it is active.
+func (r *Registry) DeleteProfile(id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	prof, ok := r.State.Profiles[id]
+	if !ok {
+		return ErrProfileNotFound
+	}
+
+	if r.profileActive(id) {
+		r.deactivate(prof)
+	}
+
+	delete(r.State.Profiles, id)
+
+	err := r.sh.SetState(*r.State)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("profile deleted:", id)
+	return nil
+}
+
+// releaseIO asks the sink devices of mappings that are no longer active to
+// blank their outputs, unless another active mapping feeds them. Sources
+// are stopped by reconcile. Devices that are disconnected are skipped.
+func (r *Registry) releaseIO(ios []IOConfig) {
+	activeOutputIds := r.activeOutputs()
+	sinkOutputs := map[uuid.UUID][]uuid.UUID{}
+	var sinkIds []uuid.UUID
+
+	for _, io := range ios {
+		delete(r.ioStatus, ioKey{inputId: io.InputId, outputId: io.OutputId})
+
+		if slices.Contains(activeOutputIds, io.OutputId) {
+			continue
+		}
+
+		sinkId := r.outputDeviceId(io.OutputId)
+		if sinkId == uuid.Nil {
+			continue
+		}
+
+		if _, ok := sinkOutputs[sinkId]; !ok {
+			sinkIds = append(sinkIds, sinkId)
+		}
+
+		sinkOutputs[sinkId] = append(sinkOutputs[sinkId], io.OutputId)
+	}
+
+	for _, sinkId := range sinkIds {
+		addr, ok := r.connsAddr[sinkId]
+		if !ok {
+			continue
+		}
+
+		reqId := uuid.New()
+		err := r.sendRequest(addr, reqId, event.SetSinkIdle{
+			RequestId: reqId,
+			OutputIds: sinkOutputs[sinkId],
+		}, nil)
 		if err != nil {
 			fmt.Println("error sending event:", err)
-			continue
 		}
 	}
+}
 
-	fmt.Println("profile enabled:", id)
-	return nil
+func (r *Registry) profileActive(id uuid.UUID) bool {
+	return slices.Contains(r.State.ActiveProfiles, id)
 }
 
 func (r *Registry) activeOutputs() []uuid.UUID {
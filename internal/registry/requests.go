@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ledctl3/event"
+	"ledctl3/pkg/uuid"
+)
+
+type IOState string
+
+const (
+	IOStateInactive IOState = "inactive"
+	IOStatePending  IOState = "pending"
+	IOStateActive   IOState = "active"
+	IOStateFailed   IOState = "failed"
+)
+
+// IOStatus is the state of an input-to-output mapping of a profile, as last
+// reported by the source device.
+type IOStatus struct {
+	InputId  uuid.UUID `json:"input_id"`
+	OutputId uuid.UUID `json:"output_id"`
+	State    IOState   `json:"state"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// DefaultRequestTimeout is how long the registry waits for a device to reply
+// to a control event before the request is failed.
+const DefaultRequestTimeout = 10 * time.Second
+
+type ioKey struct {
+	inputId  uuid.UUID
+	outputId uuid.UUID
+}
+
+// request is a control event that is awaiting an Ack or Error from the
+// device it was sent to. Inputs lists the inputs whose running outputs the
+// request changes.
+type request struct {
+	addr   string
+	ios    []ioKey
+	inputs []uuid.UUID
+	timer  *time.Timer
+}
+
+// SetRequestTimeout sets how long the registry waits for a device to reply
+// to a control event. Requests without a reply in time are failed, as if the
+// device replied with an error.
+func (r *Registry) SetRequestTimeout(d time.Duration) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.reqTimeout = d
+}
+
+// sendRequest sends a control event to the device at addr, and marks the
+// given mappings as pending until the device replies to it.
+func (r *Registry) sendRequest(addr string, id uuid.UUID, e event.Event, ios []ioKey) error {
+	r.setIOStatus(ios, IOStatePending, "")
+
+	err := r.send(addr, e)
+	if err != nil {
+		r.setIOStatus(ios, IOStateFailed, err.Error())
+		return err
+	}
+
+	r.requests[id] = request{
+		addr:   addr,
+		ios:    ios,
+		inputs: requestInputs(e),
+		timer: time.AfterFunc(r.reqTimeout, func() {
+			r.mux.Lock()
+			defer r.mux.Unlock()
+
+			r.expireRequest(id)
+		}),
+	}
+
+	return nil
+}
+
+// expireRequest fails a request the device did not reply to in time.
+func (r *Registry) expireRequest(id uuid.UUID) {
+	req, ok := r.requests[id]
+	if !ok {
+		return
+	}
+
+	fmt.Printf("%s: request %s timed out\n", req.addr, id)
+
+	r.failRequest(id, req, "request timed out")
+}
+
+// failRequest removes a pending request and marks its mappings as failed.
+// The outputs its inputs are feeding are no longer known, so they are
+// configured from scratch the next time the registry reconciles.
+func (r *Registry) failRequest(id uuid.UUID, req request, reason string) {
+	req.timer.Stop()
+	delete(r.requests, id)
+
+	r.setIOStatus(req.ios, IOStateFailed, reason)
+
+	for _, inputId := range req.inputs {
+		delete(r.running, inputId)
+	}
+}
+
+// requestInputs returns the inputs whose running outputs are changed by a
+// control event.
+func requestInputs(e event.Event) []uuid.UUID {
+	switch e := e.(type) {
+	case event.SetInputActive:
+		return []uuid.UUID{e.Id}
+	case event.SetSourceIdle:
+		var ids []uuid.UUID
+		for _, in := range e.Inputs {
+			ids = append(ids, in.InputId)
+		}
+
+		return ids
+	default:
+		return nil
+	}
+}
+
+func (r *Registry) setIOStatus(ios []ioKey, state IOState, reason string) {
+	for _, io := range ios {
+		r.ioStatus[io] = IOStatus{
+			InputId:  io.inputId,
+			OutputId: io.outputId,
+			State:    state,
+			Error:    reason,
+		}
+	}
+}
+
+// failRequests fails every pending request sent to the device at addr.
+func (r *Registry) failRequests(addr string, reason string) {
+	for id, req := range r.requests {
+		if req.addr != addr {
+			continue
+		}
+
+		r.failRequest(id, req, reason)
+	}
+}
+
+func (r *Registry) handleAck(addr string, e event.Ack) error {
+	fmt.Printf("%s: recv Ack\n", addr)
+
+	req, ok := r.requests[e.RequestId]
+	if !ok || req.addr != addr {
+		return errors.New("unknown request")
+	}
+
+	req.timer.Stop()
+	delete(r.requests, e.RequestId)
+
+	r.setIOStatus(req.ios, IOStateActive, "")
+
+	return nil
+}
+
+func (r *Registry) handleError(addr string, e event.Error) error {
+	fmt.Printf("%s: recv Error: %s: %s\n", addr, e.Code, e.Reason)
+
+	req, ok := r.requests[e.RequestId]
+	if !ok || req.addr != addr {
+		return errors.New("unknown request")
+	}
+
+	r.failRequest(e.RequestId, req, fmt.Sprintf("%s: %s", e.Code, e.Reason))
+
+	return nil
+}
+
+// ProfileStatus returns the status of each input-to-output mapping of the
+// profile with the given id.
+func (r *Registry) ProfileStatus(id uuid.UUID) ([]IOStatus, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	prof, ok := r.State.Profiles[id]
+	if !ok {
+		return nil, ErrProfileNotFound
+	}
+
+	return r.profileStatus(prof), nil
+}
+
+func (r *Registry) profileStatus(prof Profile) []IOStatus {
+	var status []IOStatus
+	for _, io := range prof.IO {
+		st, ok := r.ioStatus[ioKey{inputId: io.InputId, outputId: io.OutputId}]
+		if !ok || !r.profileActive(prof.Id) {
+			st = IOStatus{
+				InputId:  io.InputId,
+				OutputId: io.OutputId,
+				State:    IOStateInactive,
+			}
+		}
+
+		status = append(status, st)
+	}
+
+	return status
+}
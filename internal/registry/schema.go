@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"ledctl3/pkg/uuid"
+)
+
+// FieldError describes a field of a config that does not satisfy the schema
+// of its input. OutputId is set for the configs of profile mappings.
+type FieldError struct {
+	InputId     uuid.UUID `json:"input_id"`
+	OutputId    uuid.UUID `json:"output_id,omitempty"`
+	Field       string    `json:"field"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+}
+
+// ValidationError is returned when one or more configs are invalid.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Description))
+	}
+
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// validateIO checks the config of each mapping against the schema of its
+// input and returns the mappings with the schema defaults filled in.
+// Mappings whose input is unknown or has no schema are left as they are.
+func (r *Registry) validateIO(io []IOConfig) ([]IOConfig, error) {
+	valid := make([]IOConfig, 0, len(io))
+	var fields []FieldError
+
+	for _, cfg := range io {
+		in := r.input(cfg.InputId)
+		if in == nil {
+			valid = append(valid, cfg)
+			continue
+		}
+
+		config, errs, err := validateConfig(in, cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range errs {
+			f.OutputId = cfg.OutputId
+			fields = append(fields, f)
+		}
+
+		cfg.Config = config
+		valid = append(valid, cfg)
+	}
+
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	return valid, nil
+}
+
+// validateConfig checks a config against the schema of the input and
+// returns it with the schema defaults filled in, along with the fields that
+// are invalid. Configs of inputs without a schema are not checked.
+func validateConfig(in *Input, config map[string]any) (map[string]any, []FieldError, error) {
+	if in.Schema == nil {
+		return config, nil, nil
+	}
+
+	config = withDefaults(in.Schema, config)
+
+	res, err := gojsonschema.Validate(
+		gojsonschema.NewGoLoader(in.Schema),
+		gojsonschema.NewGoLoader(config),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid schema for input %s: %w", in.Id, err)
+	}
+
+	var fields []FieldError
+	for _, resErr := range res.Errors() {
+		fields = append(fields, FieldError{
+			InputId:     in.Id,
+			Field:       resErr.Field(),
+			Type:        resErr.Type(),
+			Description: resErr.Description(),
+		})
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Field < fields[j].Field
+	})
+
+	return config, fields, nil
+}
+
+// withDefaults returns a copy of the config with the defaults of the schema
+// properties that are not set, including the properties of nested objects.
+func withDefaults(schema, config map[string]any) map[string]any {
+	props, _ := schema["properties"].(map[string]any)
+
+	cfg := make(map[string]any, len(config)+len(props))
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	for name, prop := range props {
+		prop, ok := prop.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		v, ok := cfg[name]
+		if !ok {
+			def, ok := prop["default"]
+			if !ok {
+				continue
+			}
+
+			cfg[name] = def
+			continue
+		}
+
+		if nested, ok := v.(map[string]any); ok {
+			cfg[name] = withDefaults(prop, nested)
+		}
+	}
+
+	return cfg
+}
+
+func (r *Registry) input(id uuid.UUID) *Input {
+	for _, dev := range r.State.Devices {
+		if in, ok := dev.Inputs[id]; ok {
+			return in
+		}
+	}
+
+	return nil
+}
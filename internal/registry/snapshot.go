@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"ledctl3/pkg/uuid"
+)
+
+// DeviceStatus is a snapshot of a device, its inputs and outputs, and
+// whether each of them is connected.
+type DeviceStatus struct {
+	Id        uuid.UUID      `json:"id"`
+	Version   string         `json:"version"`
+	Connected bool           `json:"connected"`
+	Pending   bool           `json:"pending"`
+	Inputs    []InputStatus  `json:"inputs"`
+	Outputs   []OutputStatus `json:"outputs"`
+}
+
+type InputStatus struct {
+	Id             uuid.UUID      `json:"id"`
+	Schema         map[string]any `json:"schema"`
+	Config         map[string]any `json:"config"`
+	AssistedConfig map[string]any `json:"assisted_config,omitempty"`
+	Connected      bool           `json:"connected"`
+}
+
+type OutputStatus struct {
+	Id        uuid.UUID      `json:"id"`
+	Leds      int            `json:"leds"`
+	Schema    map[string]any `json:"schema"`
+	Config    map[string]any `json:"config"`
+	Connected bool           `json:"connected"`
+}
+
+// Devices returns every device known to the registry, sorted by id.
+func (r *Registry) Devices() []DeviceStatus {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	devs := []DeviceStatus{}
+	for _, dev := range r.State.Devices {
+		devs = append(devs, deviceStatus(dev))
+	}
+
+	sort.Slice(devs, func(i, j int) bool {
+		return devs[i].Id < devs[j].Id
+	})
+
+	return devs
+}
+
+// Device returns the device with the given id.
+func (r *Registry) Device(id uuid.UUID) (DeviceStatus, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	dev, ok := r.State.Devices[id]
+	if !ok {
+		return DeviceStatus{}, ErrDeviceNotFound
+	}
+
+	return deviceStatus(dev), nil
+}
+
+func deviceStatus(dev *Device) DeviceStatus {
+	st := DeviceStatus{
+		Id:        dev.Id,
+		Version:   dev.Version,
+		Connected: dev.Connected,
+		Pending:   dev.Pending,
+		Inputs:    []InputStatus{},
+		Outputs:   []OutputStatus{},
+	}
+
+	for _, in := range dev.Inputs {
+		st.Inputs = append(st.Inputs, InputStatus{
+			Id:             in.Id,
+			Schema:         in.Schema,
+			Config:         in.Config,
+			AssistedConfig: in.AssistedConfig,
+			Connected:      in.Connected,
+		})
+	}
+
+	for _, out := range dev.Outputs {
+		st.Outputs = append(st.Outputs, OutputStatus{
+			Id:        out.Id,
+			Leds:      out.Leds,
+			Schema:    out.Schema,
+			Config:    out.Config,
+			Connected: out.Connected,
+		})
+	}
+
+	sort.Slice(st.Inputs, func(i, j int) bool {
+		return st.Inputs[i].Id < st.Inputs[j].Id
+	})
+
+	sort.Slice(st.Outputs, func(i, j int) bool {
+		return st.Outputs[i].Id < st.Outputs[j].Id
+	})
+
+	return st
+}
+
+// Profiles returns every profile, sorted by id.
+func (r *Registry) Profiles() []Profile {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	profs := []Profile{}
+	for _, prof := range r.State.Profiles {
+		prof.IO = slices.Clone(prof.IO)
+		profs = append(profs, prof)
+	}
+
+	sort.Slice(profs, func(i, j int) bool {
+		return profs[i].Id < profs[j].Id
+	})
+
+	return profs
+}
+
+// Profile returns the profile with the given id.
+func (r *Registry) Profile(id uuid.UUID) (Profile, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	prof, ok := r.State.Profiles[id]
+	if !ok {
+		return Profile{}, ErrProfileNotFound
+	}
+
+	prof.IO = slices.Clone(prof.IO)
+
+	return prof, nil
+}
+
+// MarshalState returns the registry state encoded as JSON, as it is
+// persisted by the state holder but without the credential hashes of
+// devices.
+func (r *Registry) MarshalState() ([]byte, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	state := *r.State
+	state.Devices = make(map[uuid.UUID]*Device, len(r.State.Devices))
+
+	for id, dev := range r.State.Devices {
+		dev := *dev
+		dev.TokenHash = ""
+		state.Devices[id] = &dev
+	}
+
+	return json.Marshal(state)
+}
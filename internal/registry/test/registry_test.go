@@ -1,7 +1,10 @@
 package registry_test
 
 import (
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 
@@ -20,6 +23,50 @@ func (m mockStateHolder) GetState() (registry.State, error) {
 	return registry.State{}, nil
 }
 
+// mockTransport passes the events written by the registry to a function,
+// except for the ConnectAck replies to every Connect, which are covered by
+// TestConnectAck.
+type mockTransport func(addr string, e event.Event) error
+
+func (m mockTransport) Start() error {
+	return nil
+}
+
+func (m mockTransport) Dial(addr string) error {
+	return errors.New("not supported")
+}
+
+func (m mockTransport) Write(addr string, e event.Event) error {
+	if _, ok := e.(event.ConnectAck); ok {
+		return nil
+	}
+
+	return m(addr, e)
+}
+
+// ackTransport is a mockTransport that also passes on ConnectAck replies.
+type ackTransport struct {
+	mockTransport
+}
+
+func (m ackTransport) Write(addr string, e event.Event) error {
+	return m.mockTransport(addr, e)
+}
+
+// closed is passed to the function of a mockTransport when the registry
+// closes a connection.
+type closed struct{}
+
+func (m mockTransport) Close(addr string) error {
+	return m(addr, closed{})
+}
+
+func (m mockTransport) SetMessageHandler(h func(addr string, e event.Event)) {}
+
+func (m mockTransport) SetConnectHandler(h func(addr string)) {}
+
+func (m mockTransport) SetDisconnectHandler(h func(addr string)) {}
+
 type message struct {
 	addr string
 	e    event.Event
@@ -28,13 +75,13 @@ type message struct {
 func TestConnect(t *testing.T) {
 	sh := mockStateHolder{}
 	msgs := make([]message, 0)
-	reg := registry.New(sh, func(addr string, e event.Event) error {
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
 		msgs = append(msgs, message{
 			addr: addr,
 			e:    e,
 		})
 		return nil
-	})
+	}))
 
 	addr := uuid.New().String()
 	id := uuid.New()
@@ -68,16 +115,116 @@ func TestConnect(t *testing.T) {
 	})
 }
 
-func TestDisconnect(t *testing.T) {
+func TestConnectVersion(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	id := uuid.New()
+
+	t.Run("incompatible device rejected", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Connect{Id: id, Version: "1.0.0"})
+		assert.ErrorContains(t, err, "incompatible protocol version 1.0.0")
+		assert.Equal(t, len(reg.State.Devices), 0)
+	})
+
+	t.Run("error event sent and connection closed", func(t *testing.T) {
+		assert.Equal(t, len(msgs), 2)
+		assert.Equal(t, msgs[0].addr, addr)
+		e, ok := msgs[0].e.(event.Error)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.Code, event.ErrorCodeIncompatibleVersion)
+		assert.Equal(t, msgs[1].addr, addr)
+		assert.Equal(t, msgs[1].e, event.Event(closed{}))
+	})
+
+	t.Run("compatible device connected", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Connect{
+			Id:       id,
+			Version:  event.ProtocolVersion,
+			Codecs:   []string{"gob"},
+			Features: []event.Feature{"unsupported"},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(reg.State.Devices), 1)
+		assert.Equal(t, reg.State.Devices[id].Version, event.ProtocolVersion)
+		assert.DeepEqual(t, reg.State.Devices[id].Codecs, []string{"gob"})
+		assert.Equal(t, len(reg.State.Devices[id].Features), 0)
+	})
+
+	t.Run("no additional events sent", func(t *testing.T) {
+		assert.Equal(t, len(msgs), 2)
+	})
+}
+
+func TestConnectAck(t *testing.T) {
 	sh := mockStateHolder{}
 	msgs := make([]message, 0)
-	reg := registry.New(sh, func(addr string, e event.Event) error {
+	reg := registry.New(sh, ackTransport{func(addr string, e event.Event) error {
 		msgs = append(msgs, message{
 			addr: addr,
 			e:    e,
 		})
 		return nil
+	}})
+	reg.SetCodecs("gob", "json")
+
+	addr := uuid.New().String()
+
+	t.Run("device connected", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Connect{
+			Id:       uuid.New(),
+			Version:  event.ProtocolVersion,
+			Codecs:   []string{"msgpack", "json"},
+			Features: []event.Feature{"unsupported", event.FeatureInputConfig},
+		})
+		assert.NilError(t, err)
+	})
+
+	t.Run("negotiated reply sent", func(t *testing.T) {
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, addr)
+		assert.DeepEqual(t, msgs[0].e, event.ConnectAck{
+			Version:  event.ProtocolVersion,
+			Codecs:   []string{"json"},
+			Features: []event.Feature{event.FeatureInputConfig},
+		})
+	})
+
+	t.Run("device without a common codec rejected", func(t *testing.T) {
+		msgs = msgs[:0]
+		addr := uuid.New().String()
+
+		err := reg.ProcessEvent(addr, event.Connect{
+			Id:      uuid.New(),
+			Version: event.ProtocolVersion,
+			Codecs:  []string{"msgpack"},
+		})
+		assert.Error(t, err, "no common codec")
+
+		assert.Equal(t, len(msgs), 2)
+		assert.Equal(t, msgs[0].e.(event.Error).Code, event.ErrorCodeIncompatibleCodec)
+		assert.Equal(t, msgs[1].e, event.Event(closed{}))
 	})
+}
+
+func TestDisconnect(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
 
 	addr := uuid.New().String()
 	id := uuid.New()
@@ -114,13 +261,13 @@ func TestDisconnect(t *testing.T) {
 func TestInputConnectedDisconnected(t *testing.T) {
 	sh := mockStateHolder{}
 	msgs := make([]message, 0)
-	reg := registry.New(sh, func(addr string, e event.Event) error {
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
 		msgs = append(msgs, message{
 			addr: addr,
 			e:    e,
 		})
 		return nil
-	})
+	}))
 
 	addr := uuid.New().String()
 	devId := uuid.New()
@@ -189,13 +336,13 @@ func TestInputConnectedDisconnected(t *testing.T) {
 func TestOutputConnectedDisconnected(t *testing.T) {
 	sh := mockStateHolder{}
 	msgs := make([]message, 0)
-	reg := registry.New(sh, func(addr string, e event.Event) error {
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
 		msgs = append(msgs, message{
 			addr: addr,
 			e:    e,
 		})
 		return nil
-	})
+	}))
 
 	addr := uuid.New().String()
 	devId := uuid.New()
@@ -265,13 +412,13 @@ func TestOutputConnectedDisconnected(t *testing.T) {
 func TestCreateProfile(t *testing.T) {
 	sh := mockStateHolder{}
 	msgs := make([]message, 0)
-	reg := registry.New(sh, func(addr string, e event.Event) error {
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
 		msgs = append(msgs, message{
 			addr: addr,
 			e:    e,
 		})
 		return nil
-	})
+	}))
 
 	addr := uuid.New().String()
 	devId := uuid.New()
@@ -330,16 +477,280 @@ func TestCreateProfile(t *testing.T) {
 	})
 }
 
+func TestCreateProfileSchema(t *testing.T) {
+	reg := registry.New(mockStateHolder{}, mockTransport(func(addr string, e event.Event) error {
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	devId := uuid.New()
+	inId := uuid.New()
+	outId := uuid.New()
+
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"width": map[string]any{
+				"type":    "integer",
+				"default": 1920.0,
+				"minimum": 1.0,
+			},
+			"framerate": map[string]any{
+				"type":    "integer",
+				"default": 60.0,
+				"minimum": 1.0,
+			},
+		},
+		"required": []any{"width", "framerate"},
+	}
+
+	err := reg.ProcessEvent(addr, event.Connect{Id: devId})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.InputConnected{Id: inId, Schema: schema})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.OutputConnected{Id: outId, Leds: 40})
+	assert.NilError(t, err)
+
+	t.Run("defaults filled in", func(t *testing.T) {
+		prof, err := reg.CreateProfile("test", []registry.IOConfig{
+			{InputId: inId, OutputId: outId, Config: map[string]any{"width": 2560.0}},
+		})
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, prof.IO[0].Config, map[string]any{
+			"width":     2560.0,
+			"framerate": 60.0,
+		})
+	})
+
+	t.Run("invalid fields reported", func(t *testing.T) {
+		_, err := reg.CreateProfile("test", []registry.IOConfig{
+			{InputId: inId, OutputId: outId, Config: map[string]any{"width": 0.0, "framerate": "fast"}},
+		})
+
+		var verr *registry.ValidationError
+		assert.Assert(t, errors.As(err, &verr))
+		assert.Equal(t, len(verr.Fields), 2)
+
+		assert.Equal(t, verr.Fields[0].Field, "framerate")
+		assert.Equal(t, verr.Fields[0].Type, "invalid_type")
+		assert.Equal(t, verr.Fields[1].Field, "width")
+		assert.Equal(t, verr.Fields[1].Type, "number_gte")
+		assert.Equal(t, verr.Fields[1].InputId, inId)
+	})
+
+	t.Run("update validated", func(t *testing.T) {
+		prof := reg.Profiles()[0]
+
+		_, err := reg.UpdateProfile(prof.Id, "", []registry.IOConfig{
+			{InputId: inId, OutputId: outId, Config: map[string]any{"width": -1.0}},
+		})
+
+		var verr *registry.ValidationError
+		assert.Assert(t, errors.As(err, &verr))
+	})
+}
+
+func TestSetInputConfig(t *testing.T) {
+	msgs := make([]message, 0)
+	reg := registry.New(mockStateHolder{}, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	devId := uuid.New()
+	inId := uuid.New()
+
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"framerate": map[string]any{
+				"type":    "integer",
+				"default": 60.0,
+				"minimum": 1.0,
+			},
+		},
+	}
+
+	err := reg.ProcessEvent(addr, event.Connect{Id: devId, Features: []event.Feature{event.FeatureInputConfig}})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.InputConnected{Id: inId, Schema: schema})
+	assert.NilError(t, err)
+
+	t.Run("unknown input", func(t *testing.T) {
+		_, err := reg.SetInputConfig(uuid.New(), nil)
+		assert.ErrorIs(t, err, registry.ErrInputNotFound)
+	})
+
+	t.Run("invalid config rejected", func(t *testing.T) {
+		_, err := reg.SetInputConfig(inId, map[string]any{"framerate": 0.0})
+
+		var verr *registry.ValidationError
+		assert.Assert(t, errors.As(err, &verr))
+		assert.Equal(t, verr.Fields[0].Field, "framerate")
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	var reqId uuid.UUID
+
+	t.Run("config pushed to device", func(t *testing.T) {
+		config, err := reg.SetInputConfig(inId, map[string]any{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, config, map[string]any{"framerate": 60.0})
+
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, addr)
+
+		e, ok := msgs[0].e.(event.SetInputConfig)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.InputId, inId)
+		assert.DeepEqual(t, e.Config, config)
+
+		reqId = e.RequestId
+		msgs = msgs[:0]
+	})
+
+	t.Run("applied config stored", func(t *testing.T) {
+		applied := map[string]any{"framerate": 30.0}
+
+		err := reg.ProcessEvent(addr, event.InputConfigApplied{RequestId: reqId, InputId: inId, Config: applied})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.Ack{RequestId: reqId})
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, reg.State.Devices[devId].Inputs[inId].Config, applied)
+	})
+
+	t.Run("config sent again after device restart", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.Connect{Id: devId, Features: []event.Feature{event.FeatureInputConfig}})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.InputConnected{Id: inId, Schema: schema})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		e, ok := msgs[0].e.(event.SetInputConfig)
+		assert.Assert(t, ok)
+		assert.DeepEqual(t, e.Config, map[string]any{"framerate": 30.0})
+	})
+}
+
+func TestAssistedSetup(t *testing.T) {
+	msgs := make([]message, 0)
+	reg := registry.New(mockStateHolder{}, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	devId := uuid.New()
+	inId := uuid.New()
+	outId := uuid.New()
+
+	err := reg.ProcessEvent(addr, event.Connect{Id: devId, Features: []event.Feature{event.FeatureAssistedSetup, event.FeatureInputConfig}})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.InputConnected{Id: inId})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.OutputConnected{Id: outId, Leds: 40})
+	assert.NilError(t, err)
+
+	proposed := map[string]any{"width": 2560.0, "height": 1440.0}
+
+	t.Run("setup requested from device", func(t *testing.T) {
+		err := reg.RequestAssistedSetup(inId)
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, addr)
+
+		e, ok := msgs[0].e.(event.AssistedSetup)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.InputId, inId)
+
+		err = reg.ProcessEvent(addr, event.AssistedSetupConfig{RequestId: e.RequestId, InputId: inId, Config: proposed})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.Ack{RequestId: e.RequestId})
+		assert.NilError(t, err)
+
+		dev, err := reg.Device(devId)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, dev.Inputs[0].AssistedConfig, proposed)
+	})
+
+	t.Run("proposed config applied to the input", func(t *testing.T) {
+		dev, err := reg.Device(devId)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, dev.Inputs[0].Config, proposed)
+
+		assert.Equal(t, len(msgs), 2)
+
+		e, ok := msgs[1].e.(event.SetInputConfig)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.InputId, inId)
+		assert.DeepEqual(t, e.Config, proposed)
+	})
+
+	t.Run("config of the input kept", func(t *testing.T) {
+		config := map[string]any{"width": 1280.0}
+
+		_, err := reg.SetInputConfig(inId, config)
+		assert.NilError(t, err)
+
+		msgs = msgs[:0]
+
+		err = reg.RequestAssistedSetup(inId)
+		assert.NilError(t, err)
+
+		e, ok := msgs[0].e.(event.AssistedSetup)
+		assert.Assert(t, ok)
+
+		err = reg.ProcessEvent(addr, event.AssistedSetupConfig{RequestId: e.RequestId, InputId: inId, Config: proposed})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+
+		dev, err := reg.Device(devId)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, dev.Inputs[0].Config, config)
+		assert.DeepEqual(t, dev.Inputs[0].AssistedConfig, proposed)
+	})
+
+	t.Run("disconnected input", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.InputDisconnected{Id: inId})
+		assert.NilError(t, err)
+
+		err = reg.RequestAssistedSetup(inId)
+		assert.ErrorContains(t, err, "input disconnected")
+	})
+}
+
 func TestEnableProfile(t *testing.T) {
 	sh := mockStateHolder{}
 	msgs := make([]message, 0)
-	reg := registry.New(sh, func(addr string, e event.Event) error {
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
 		msgs = append(msgs, message{
 			addr: addr,
 			e:    e,
 		})
 		return nil
-	})
+	}))
 
 	addr := uuid.New().String()
 	devId := uuid.New()
@@ -347,7 +758,7 @@ func TestEnableProfile(t *testing.T) {
 	outId := uuid.New()
 
 	t.Run("cannot enable non-existent profile", func(t *testing.T) {
-		err := reg.EnableProfile(uuid.New())
+		_, err := reg.EnableProfile(uuid.New())
 		assert.Error(t, err, "profile not found")
 	})
 
@@ -395,15 +806,22 @@ func TestEnableProfile(t *testing.T) {
 	})
 
 	t.Run("profile enabled", func(t *testing.T) {
-		err := reg.EnableProfile(id)
+		status, err := reg.EnableProfile(id)
 		assert.NilError(t, err)
+		assert.DeepEqual(t, status, []registry.IOStatus{
+			{InputId: inId, OutputId: outId, State: registry.IOStatePending},
+		})
 	})
 
 	t.Run("enableInput event sent", func(t *testing.T) {
 		assert.Equal(t, len(msgs), 1)
 		assert.Equal(t, msgs[0].addr, addr)
-		assert.DeepEqual(t, msgs[0].e, event.SetInputActive{
-			Id: inId,
+		e, ok := msgs[0].e.(event.SetInputActive)
+		assert.Assert(t, ok)
+		assert.Assert(t, e.RequestId != "")
+		assert.DeepEqual(t, e, event.SetInputActive{
+			RequestId: e.RequestId,
+			Id:        inId,
 			Outputs: []event.SetInputActiveOutput{
 				{
 					Id:     outId,
@@ -416,7 +834,7 @@ func TestEnableProfile(t *testing.T) {
 	})
 
 	t.Run("cannot re-enable profile", func(t *testing.T) {
-		err := reg.EnableProfile(id)
+		_, err := reg.EnableProfile(id)
 		assert.Error(t, err, "profile already enabled")
 	})
 
@@ -424,3 +842,986 @@ func TestEnableProfile(t *testing.T) {
 		assert.Equal(t, len(msgs), 1)
 	})
 }
+
+func TestDataPlane(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	dataMsgs := make([]message, 0)
+	reg.SetDataPlane(4000, func(addr string, e event.Event) error {
+		dataMsgs = append(dataMsgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	})
+
+	srcAddr := "10.0.0.2:50000"
+	srcId := uuid.New()
+	sinkAddr := "10.0.0.3:50000"
+	sinkId := uuid.New()
+	inId := uuid.New()
+	outId := uuid.New()
+
+	t.Run("source without data plane connected", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Connect{
+			Id:      srcId,
+			Version: event.ProtocolVersion,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	t.Run("sink with data plane connected", func(t *testing.T) {
+		err := reg.ProcessEvent(sinkAddr, event.Connect{
+			Id:       sinkId,
+			Version:  event.ProtocolVersion,
+			Features: []event.Feature{event.FeatureUDPData},
+			DataPort: 5000,
+		})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.OutputConnected{
+			Id:   outId,
+			Leds: 40,
+		})
+		assert.NilError(t, err)
+
+		assert.Assert(t, reg.State.Devices[sinkId].HasFeature(event.FeatureUDPData))
+	})
+
+	t.Run("data channel sent", func(t *testing.T) {
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, sinkAddr)
+		assert.DeepEqual(t, msgs[0].e, event.DataChannel{Port: 4000})
+	})
+
+	t.Run("source mapped to the sink", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.InputConnected{Id: inId})
+		assert.NilError(t, err)
+
+		prof, err := reg.CreateProfile("data", []registry.IOConfig{
+			{InputId: inId, OutputId: outId},
+		})
+		assert.NilError(t, err)
+
+		_, err = reg.EnableProfile(prof.Id)
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 2)
+		assert.Equal(t, msgs[1].addr, srcAddr)
+	})
+
+	t.Run("data forwarded over the data plane", func(t *testing.T) {
+		e := event.Data{
+			SinkId:  sinkId,
+			Outputs: []event.DataOutput{{Id: outId}},
+		}
+
+		err := reg.ProcessEvent(srcAddr, e)
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(dataMsgs), 1)
+		assert.Equal(t, dataMsgs[0].addr, "10.0.0.3:5000")
+		assert.DeepEqual(t, dataMsgs[0].e, event.Event(e))
+	})
+
+	t.Run("data for outputs the source is not feeding dropped", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Data{
+			SinkId:  sinkId,
+			Outputs: []event.DataOutput{{Id: uuid.New()}},
+		})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(dataMsgs), 1)
+	})
+
+	t.Run("only data from known peers accepted over the data plane", func(t *testing.T) {
+		e := event.Data{SinkId: sinkId}
+
+		err := reg.ProcessData("10.0.0.9:5000", e)
+		assert.ErrorContains(t, err, "unknown data peer")
+
+		err = reg.ProcessData("10.0.0.3:5000", event.Connect{Id: uuid.New()})
+		assert.ErrorContains(t, err, "unexpected")
+
+		assert.Equal(t, len(dataMsgs), 1)
+		assert.Equal(t, len(msgs), 2)
+
+		// accepted, but the sink does not feed any outputs itself
+		err = reg.ProcessData("10.0.0.3:5000", event.Data{
+			SinkId:  sinkId,
+			Outputs: []event.DataOutput{{Id: outId}},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(dataMsgs), 1)
+	})
+
+	t.Run("data channel closed on disconnect", func(t *testing.T) {
+		err := reg.ProcessEvent(sinkAddr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{
+			Id:      sinkId,
+			Version: event.ProtocolVersion,
+		})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.OutputConnected{
+			Id:   outId,
+			Leds: 40,
+		})
+		assert.NilError(t, err)
+
+		msgs = msgs[:0]
+
+		e := event.Data{
+			SinkId:  sinkId,
+			Outputs: []event.DataOutput{{Id: outId}},
+		}
+
+		err = reg.ProcessEvent(srcAddr, e)
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(dataMsgs), 1)
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, sinkAddr)
+		assert.DeepEqual(t, msgs[0].e, event.Event(e))
+	})
+}
+
+func TestEnableProfileStatus(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	devId := uuid.New()
+	in1Id := uuid.New()
+	in2Id := uuid.New()
+	out1Id := uuid.New()
+	out2Id := uuid.New()
+
+	t.Run("device with inputs and outputs connected", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Connect{Id: devId})
+		assert.NilError(t, err)
+
+		for _, id := range []uuid.UUID{in1Id, in2Id} {
+			err = reg.ProcessEvent(addr, event.InputConnected{Id: id})
+			assert.NilError(t, err)
+		}
+
+		for _, id := range []uuid.UUID{out1Id, out2Id} {
+			err = reg.ProcessEvent(addr, event.OutputConnected{Id: id, Leds: 40})
+			assert.NilError(t, err)
+		}
+	})
+
+	prof, err := reg.CreateProfile("test", []registry.IOConfig{
+		{InputId: in1Id, OutputId: out1Id},
+		{InputId: in2Id, OutputId: out2Id},
+	})
+	assert.NilError(t, err)
+
+	t.Run("status inactive before enabling", func(t *testing.T) {
+		status, err := reg.ProfileStatus(prof.Id)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, status, []registry.IOStatus{
+			{InputId: in1Id, OutputId: out1Id, State: registry.IOStateInactive},
+			{InputId: in2Id, OutputId: out2Id, State: registry.IOStateInactive},
+		})
+	})
+
+	t.Run("profile enabled", func(t *testing.T) {
+		_, err := reg.EnableProfile(prof.Id)
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 2)
+	})
+
+	t.Run("device replies", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Ack{
+			RequestId: msgs[0].e.(event.SetInputActive).RequestId,
+		})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.Error{
+			RequestId: msgs[1].e.(event.SetInputActive).RequestId,
+			Code:      event.ErrorCodeInputStartFailed,
+			Reason:    "display unavailable",
+		})
+		assert.NilError(t, err)
+	})
+
+	t.Run("status reflects replies", func(t *testing.T) {
+		status, err := reg.ProfileStatus(prof.Id)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, status, []registry.IOStatus{
+			{InputId: in1Id, OutputId: out1Id, State: registry.IOStateActive},
+			{
+				InputId:  in2Id,
+				OutputId: out2Id,
+				State:    registry.IOStateFailed,
+				Error:    "input_start_failed: display unavailable",
+			},
+		})
+	})
+
+	t.Run("unknown request", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Ack{RequestId: uuid.New()})
+		assert.Error(t, err, "unknown request")
+	})
+}
+
+func TestRequestTimeout(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+	reg.SetRequestTimeout(10 * time.Millisecond)
+
+	addr := uuid.New().String()
+	devId := uuid.New()
+	inId := uuid.New()
+	outId := uuid.New()
+
+	t.Run("device with input and output connected", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Connect{Id: devId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.InputConnected{Id: inId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(addr, event.OutputConnected{Id: outId, Leds: 40})
+		assert.NilError(t, err)
+	})
+
+	prof, err := reg.CreateProfile("test", []registry.IOConfig{
+		{InputId: inId, OutputId: outId},
+	})
+	assert.NilError(t, err)
+
+	t.Run("profile enabled", func(t *testing.T) {
+		_, err := reg.EnableProfile(prof.Id)
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 1)
+	})
+
+	t.Run("request failed when the device does not reply", func(t *testing.T) {
+		time.Sleep(50 * time.Millisecond)
+
+		status, err := reg.ProfileStatus(prof.Id)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, status, []registry.IOStatus{
+			{
+				InputId:  inId,
+				OutputId: outId,
+				State:    registry.IOStateFailed,
+				Error:    "request timed out",
+			},
+		})
+	})
+
+	t.Run("late reply rejected", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Ack{
+			RequestId: msgs[0].e.(event.SetInputActive).RequestId,
+		})
+		assert.Error(t, err, "unknown request")
+	})
+}
+
+func TestDisableProfile(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	srcAddr := uuid.New().String()
+	srcId := uuid.New()
+	sinkAddr := uuid.New().String()
+	sinkId := uuid.New()
+	inId := uuid.New()
+	out1Id := uuid.New()
+	out2Id := uuid.New()
+
+	t.Run("devices connected", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Connect{Id: srcId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: inId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId})
+		assert.NilError(t, err)
+
+		for _, id := range []uuid.UUID{out1Id, out2Id} {
+			err = reg.ProcessEvent(sinkAddr, event.OutputConnected{Id: id, Leds: 40})
+			assert.NilError(t, err)
+		}
+	})
+
+	prof, err := reg.CreateProfile("test", []registry.IOConfig{
+		{InputId: inId, OutputId: out1Id},
+		{InputId: inId, OutputId: out2Id},
+	})
+	assert.NilError(t, err)
+
+	t.Run("disabling an inactive profile fails", func(t *testing.T) {
+		err := reg.DisableProfile(prof.Id)
+		assert.Error(t, err, "profile not enabled")
+	})
+
+	_, err = reg.EnableProfile(prof.Id)
+	assert.NilError(t, err)
+	msgs = msgs[:0]
+
+	t.Run("profile disabled", func(t *testing.T) {
+		err := reg.DisableProfile(prof.Id)
+		assert.NilError(t, err)
+		assert.Equal(t, len(reg.State.ActiveProfiles), 0)
+		assert.Equal(t, len(msgs), 2)
+
+		// the source is stopped before the sink is blanked
+		assert.Equal(t, msgs[0].addr, srcAddr)
+		idle, ok := msgs[0].e.(event.SetSourceIdle)
+		assert.Assert(t, ok)
+		assert.Equal(t, len(idle.Inputs), 1)
+		assert.Equal(t, idle.Inputs[0].InputId, inId)
+		assert.DeepEqual(t, idle.Inputs[0].OutputIds, []uuid.UUID{out1Id, out2Id})
+
+		assert.Equal(t, msgs[1].addr, sinkAddr)
+		sinkIdle, ok := msgs[1].e.(event.SetSinkIdle)
+		assert.Assert(t, ok)
+		assert.DeepEqual(t, sinkIdle.OutputIds, []uuid.UUID{out1Id, out2Id})
+	})
+
+	t.Run("devices acknowledge", func(t *testing.T) {
+		for _, msg := range msgs {
+			var reqId uuid.UUID
+			switch e := msg.e.(type) {
+			case event.SetSourceIdle:
+				reqId = e.RequestId
+			case event.SetSinkIdle:
+				reqId = e.RequestId
+			}
+
+			err := reg.ProcessEvent(msg.addr, event.Ack{RequestId: reqId})
+			assert.NilError(t, err)
+		}
+	})
+
+	t.Run("status inactive after disabling", func(t *testing.T) {
+		status, err := reg.ProfileStatus(prof.Id)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, status, []registry.IOStatus{
+			{InputId: inId, OutputId: out1Id, State: registry.IOStateInactive},
+			{InputId: inId, OutputId: out2Id, State: registry.IOStateInactive},
+		})
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		err := reg.DisableProfile(uuid.New())
+		assert.ErrorIs(t, err, registry.ErrProfileNotFound)
+	})
+}
+
+func TestUpdateProfile(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	srcAddr := uuid.New().String()
+	srcId := uuid.New()
+	sinkAddr := uuid.New().String()
+	sinkId := uuid.New()
+	in1Id := uuid.New()
+	in2Id := uuid.New()
+	out1Id := uuid.New()
+	out2Id := uuid.New()
+	out3Id := uuid.New()
+
+	t.Run("devices connected", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Connect{Id: srcId})
+		assert.NilError(t, err)
+
+		for _, id := range []uuid.UUID{in1Id, in2Id} {
+			err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: id})
+			assert.NilError(t, err)
+		}
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId})
+		assert.NilError(t, err)
+
+		for _, id := range []uuid.UUID{out1Id, out2Id, out3Id} {
+			err = reg.ProcessEvent(sinkAddr, event.OutputConnected{Id: id, Leds: 40})
+			assert.NilError(t, err)
+		}
+	})
+
+	prof, err := reg.CreateProfile("test", []registry.IOConfig{
+		{InputId: in1Id, OutputId: out1Id},
+		{InputId: in1Id, OutputId: out2Id},
+	})
+	assert.NilError(t, err)
+
+	t.Run("inactive profile updated", func(t *testing.T) {
+		_, err := reg.UpdateProfile(prof.Id, "", []registry.IOConfig{
+			{InputId: in1Id, OutputId: out1Id},
+			{InputId: in1Id, OutputId: out2Id, Config: map[string]any{"reverse": true}},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	_, err = reg.EnableProfile(prof.Id)
+	assert.NilError(t, err)
+	msgs = msgs[:0]
+
+	t.Run("only changed mappings reconfigured", func(t *testing.T) {
+		updated, err := reg.UpdateProfile(prof.Id, "", []registry.IOConfig{
+			{InputId: in1Id, OutputId: out1Id},
+			{InputId: in2Id, OutputId: out3Id},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(updated.IO), 2)
+		assert.Equal(t, len(msgs), 3)
+
+		assert.Equal(t, msgs[0].addr, srcAddr)
+		assert.DeepEqual(t, msgs[0].e.(event.SetSourceIdle).Inputs, []event.SetSourceIdleInput{
+			{InputId: in1Id, OutputIds: []uuid.UUID{out2Id}},
+		})
+
+		assert.Equal(t, msgs[1].addr, sinkAddr)
+		assert.DeepEqual(t, msgs[1].e.(event.SetSinkIdle).OutputIds, []uuid.UUID{out2Id})
+
+		assert.Equal(t, msgs[2].addr, srcAddr)
+		e := msgs[2].e.(event.SetInputActive)
+		assert.Equal(t, e.Id, in2Id)
+		assert.Equal(t, len(e.Outputs), 1)
+		assert.Equal(t, e.Outputs[0].Id, out3Id)
+	})
+
+	t.Run("output in use by another profile", func(t *testing.T) {
+		other, err := reg.CreateProfile("other", []registry.IOConfig{
+			{InputId: in2Id, OutputId: out2Id},
+		})
+		assert.NilError(t, err)
+
+		_, err = reg.EnableProfile(other.Id)
+		assert.NilError(t, err)
+
+		_, err = reg.UpdateProfile(prof.Id, "", []registry.IOConfig{
+			{InputId: in1Id, OutputId: out2Id},
+		})
+		assert.Error(t, err, "output already in use")
+	})
+
+	t.Run("profile renamed", func(t *testing.T) {
+		renamed, err := reg.RenameProfile(prof.Id, "renamed")
+		assert.NilError(t, err)
+		assert.Equal(t, renamed.Name, "renamed")
+		assert.Equal(t, reg.State.Profiles[prof.Id].Name, "renamed")
+	})
+
+	t.Run("profile not renamed to an empty name", func(t *testing.T) {
+		_, err := reg.RenameProfile(prof.Id, "")
+		assert.ErrorIs(t, err, registry.ErrEmptyName)
+		assert.Equal(t, reg.State.Profiles[prof.Id].Name, "renamed")
+	})
+
+	t.Run("active profile deleted", func(t *testing.T) {
+		msgs = msgs[:0]
+
+		err := reg.DeleteProfile(prof.Id)
+		assert.NilError(t, err)
+
+		_, ok := reg.State.Profiles[prof.Id]
+		assert.Assert(t, !ok)
+		assert.Assert(t, !slices.Contains(reg.State.ActiveProfiles, prof.Id))
+		assert.Equal(t, len(msgs), 2)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := reg.UpdateProfile(prof.Id, "", []registry.IOConfig{{InputId: in1Id, OutputId: out1Id}})
+		assert.ErrorIs(t, err, registry.ErrProfileNotFound)
+
+		err = reg.DeleteProfile(prof.Id)
+		assert.ErrorIs(t, err, registry.ErrProfileNotFound)
+	})
+}
+
+// stateHolder starts the registry with the given state.
+type stateHolder struct {
+	state registry.State
+}
+
+func (s stateHolder) SetState(state registry.State) error {
+	return nil
+}
+
+func (s stateHolder) GetState() (registry.State, error) {
+	return s.state, nil
+}
+
+// failingStateHolder cannot persist the state while fail is set.
+type failingStateHolder struct {
+	fail *bool
+}
+
+func (s failingStateHolder) SetState(state registry.State) error {
+	if *s.fail {
+		return errors.New("disk full")
+	}
+
+	return nil
+}
+
+func (s failingStateHolder) GetState() (registry.State, error) {
+	return registry.State{}, nil
+}
+
+func TestProfileNotPersisted(t *testing.T) {
+	fail := false
+	reg := registry.New(failingStateHolder{fail: &fail}, mockTransport(func(addr string, e event.Event) error {
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	inId := uuid.New()
+	outId := uuid.New()
+
+	err := reg.ProcessEvent(addr, event.Connect{Id: uuid.New()})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.InputConnected{Id: inId})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(addr, event.OutputConnected{Id: outId, Leds: 40})
+	assert.NilError(t, err)
+
+	prof, err := reg.CreateProfile("test", []registry.IOConfig{{InputId: inId, OutputId: outId}})
+	assert.NilError(t, err)
+
+	fail = true
+
+	t.Run("update rolled back", func(t *testing.T) {
+		_, err := reg.UpdateProfile(prof.Id, "updated", []registry.IOConfig{{InputId: inId, OutputId: outId, Config: map[string]any{"width": 1.0}}})
+		assert.ErrorContains(t, err, "disk full")
+		assert.DeepEqual(t, reg.State.Profiles[prof.Id], prof)
+	})
+
+	t.Run("rename rolled back", func(t *testing.T) {
+		_, err := reg.RenameProfile(prof.Id, "renamed")
+		assert.ErrorContains(t, err, "disk full")
+		assert.DeepEqual(t, reg.State.Profiles[prof.Id], prof)
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	srcId := uuid.New()
+	sinkId := uuid.New()
+	in1Id := uuid.New()
+	in2Id := uuid.New()
+	outId := uuid.New()
+	profId := uuid.New()
+
+	// state of a registry that restarted with an active profile
+	sh := stateHolder{state: registry.State{
+		Devices: map[uuid.UUID]*registry.Device{
+			srcId: {
+				Id: srcId,
+				Inputs: map[uuid.UUID]*registry.Input{
+					in1Id: {Id: in1Id},
+					in2Id: {Id: in2Id},
+				},
+			},
+			sinkId: {
+				Id:      sinkId,
+				Outputs: map[uuid.UUID]*registry.Output{outId: {Id: outId, Leds: 40}},
+			},
+		},
+		Profiles: map[uuid.UUID]registry.Profile{
+			profId: {Id: profId, IO: []registry.IOConfig{{InputId: in1Id, OutputId: outId}}},
+		},
+		ActiveProfiles: []uuid.UUID{profId},
+	}}
+
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	srcAddr := uuid.New().String()
+	sinkAddr := uuid.New().String()
+
+	running := []event.SetInputActiveOutput{{Id: outId, SinkId: sinkId, Leds: 40}}
+
+	t.Run("nothing sent for inputs already feeding their outputs", func(t *testing.T) {
+		err := reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.OutputConnected{Id: outId, Leds: 40})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(srcAddr, event.Connect{Id: srcId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: in1Id, Outputs: running})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+
+		status, err := reg.ProfileStatus(profId)
+		assert.NilError(t, err)
+		assert.Equal(t, status[0].State, registry.IOStateActive)
+	})
+
+	t.Run("stale outputs are released", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.InputConnected{Id: in2Id, Outputs: running})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, srcAddr)
+		assert.DeepEqual(t, msgs[0].e.(event.SetSourceIdle).Inputs, []event.SetSourceIdleInput{
+			{InputId: in2Id, OutputIds: []uuid.UUID{outId}},
+		})
+		msgs = msgs[:0]
+	})
+
+	t.Run("sink reconnect resumes its outputs", func(t *testing.T) {
+		err := reg.ProcessEvent(sinkAddr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		assert.DeepEqual(t, msgs[0].e.(event.SetSourceIdle).Inputs, []event.SetSourceIdleInput{
+			{InputId: in1Id, OutputIds: []uuid.UUID{outId}},
+		})
+
+		status, err := reg.ProfileStatus(profId)
+		assert.NilError(t, err)
+		assert.Equal(t, status[0].Error, "output disconnected")
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.OutputConnected{Id: outId, Leds: 40})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 2)
+		e, ok := msgs[1].e.(event.SetInputActive)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.Id, in1Id)
+		assert.DeepEqual(t, e.Outputs, running)
+		msgs = msgs[:0]
+	})
+
+	t.Run("device back under a new address", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Disconnect{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+
+		srcAddr = uuid.New().String()
+
+		err = reg.ProcessEvent(srcAddr, event.Connect{Id: srcId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: in1Id})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, srcAddr)
+		_, ok := msgs[0].e.(event.SetInputActive)
+		assert.Assert(t, ok)
+	})
+
+	t.Run("failed activation is retried", func(t *testing.T) {
+		e := msgs[0].e.(event.SetInputActive)
+		msgs = msgs[:0]
+
+		err := reg.ProcessEvent(srcAddr, event.Error{RequestId: e.RequestId, Code: event.ErrorCodeInputStartFailed})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+
+		// any later change makes the registry reconcile again
+		err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: in2Id})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		retry, ok := msgs[0].e.(event.SetInputActive)
+		assert.Assert(t, ok)
+		assert.Equal(t, retry.Id, in1Id)
+		assert.Assert(t, retry.RequestId != e.RequestId)
+		msgs = msgs[:0]
+	})
+
+	t.Run("device back under a new address before the old one drops", func(t *testing.T) {
+		oldAddr := srcAddr
+		srcAddr = uuid.New().String()
+
+		err := reg.ProcessEvent(srcAddr, event.Connect{Id: srcId})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(oldAddr, event.Disconnect{})
+		assert.Error(t, err, "device already disconnected")
+
+		assert.Assert(t, reg.State.Devices[srcId].Connected)
+
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, srcAddr)
+		e, ok := msgs[0].e.(event.SetInputActive)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.Id, in1Id)
+	})
+}
+
+func TestPairing(t *testing.T) {
+	sh := mockStateHolder{}
+	msgs := make([]message, 0)
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		msgs = append(msgs, message{
+			addr: addr,
+			e:    e,
+		})
+		return nil
+	}))
+
+	reg.SetPairingRequired(true)
+
+	srcAddr := uuid.New().String()
+	srcId := uuid.New()
+	sinkAddr := uuid.New().String()
+	sinkId := uuid.New()
+	inputId := uuid.New()
+	outputId := uuid.New()
+
+	var token string
+
+	t.Run("credential issued on first contact", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Connect{Id: srcId})
+		assert.NilError(t, err)
+		assert.Assert(t, reg.State.Devices[srcId].Pending)
+
+		assert.Equal(t, len(msgs), 1)
+		paired, ok := msgs[0].e.(event.Paired)
+		assert.Assert(t, ok)
+		assert.Assert(t, paired.Token != "")
+		assert.Assert(t, reg.State.Devices[srcId].TokenHash != paired.Token)
+
+		token = paired.Token
+		msgs = msgs[:0]
+	})
+
+	err := reg.ProcessEvent(srcAddr, event.InputConnected{Id: inputId})
+	assert.NilError(t, err)
+
+	err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId})
+	assert.NilError(t, err)
+	sinkToken := msgs[0].e.(event.Paired).Token
+	msgs = msgs[:0]
+
+	err = reg.ProcessEvent(sinkAddr, event.OutputConnected{Id: outputId, Leds: 10})
+	assert.NilError(t, err)
+
+	err = reg.AdoptDevice(sinkId)
+	assert.NilError(t, err)
+
+	prof, err := reg.CreateProfile("test", []registry.IOConfig{{InputId: inputId, OutputId: outputId}})
+	assert.NilError(t, err)
+
+	t.Run("pending devices are not activated", func(t *testing.T) {
+		status, err := reg.EnableProfile(prof.Id)
+		assert.NilError(t, err)
+		assert.Equal(t, status[0].State, registry.IOStateFailed)
+		assert.Equal(t, status[0].Error, "device pending approval")
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	t.Run("data from pending devices is dropped", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Data{SinkId: sinkId})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	t.Run("pending device keeps its credential on reconnect", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(srcAddr, event.Connect{Id: srcId, Token: token})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+
+		err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: inputId})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	t.Run("pending device cannot be impersonated", func(t *testing.T) {
+		err := reg.ProcessEvent(srcAddr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		hash := reg.State.Devices[srcId].TokenHash
+		fakeAddr := uuid.New().String()
+
+		err = reg.ProcessEvent(fakeAddr, event.Connect{Id: srcId})
+		assert.ErrorContains(t, err, "invalid credential")
+
+		assert.Equal(t, len(msgs), 2)
+		assert.Equal(t, msgs[0].addr, fakeAddr)
+		assert.Equal(t, msgs[0].e.(event.Error).Code, event.ErrorCodeUnauthorized)
+		assert.Equal(t, msgs[1].addr, fakeAddr)
+		assert.Equal(t, msgs[1].e, event.Event(closed{}))
+		assert.Equal(t, reg.State.Devices[srcId].TokenHash, hash)
+		msgs = msgs[:0]
+
+		err = reg.ProcessEvent(srcAddr, event.Connect{Id: srcId, Token: token})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(srcAddr, event.InputConnected{Id: inputId})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	t.Run("adopted device is activated", func(t *testing.T) {
+		err := reg.AdoptDevice(srcId)
+		assert.NilError(t, err)
+		assert.Assert(t, !reg.State.Devices[srcId].Pending)
+
+		assert.Equal(t, len(msgs), 1)
+		_, ok := msgs[0].e.(event.SetInputActive)
+		assert.Assert(t, ok)
+		msgs = msgs[:0]
+
+		err = reg.AdoptDevice(srcId)
+		assert.Error(t, err, "device not pending approval")
+	})
+
+	t.Run("adopted device is rejected with an invalid credential", func(t *testing.T) {
+		err := reg.ProcessEvent(sinkAddr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		// the source stops feeding the disconnected sink
+		assert.Equal(t, len(msgs), 1)
+		_, ok := msgs[0].e.(event.SetSourceIdle)
+		assert.Assert(t, ok)
+		msgs = msgs[:0]
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId, Token: "invalid"})
+		assert.Error(t, err, "invalid credential")
+
+		assert.Equal(t, len(msgs), 2)
+		e, ok := msgs[0].e.(event.Error)
+		assert.Assert(t, ok)
+		assert.Equal(t, e.Code, event.ErrorCodeUnauthorized)
+		assert.Equal(t, msgs[1].e, event.Event(closed{}))
+		msgs = msgs[:0]
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId, Token: sinkToken})
+		assert.NilError(t, err)
+		assert.Equal(t, len(msgs), 0)
+	})
+
+	t.Run("reset device is disconnected and paired again", func(t *testing.T) {
+		err := reg.ResetDevice(sinkId)
+		assert.NilError(t, err)
+		assert.Assert(t, reg.State.Devices[sinkId].Pending)
+
+		assert.Equal(t, len(msgs), 1)
+		assert.Equal(t, msgs[0].addr, sinkAddr)
+		assert.Equal(t, msgs[0].e, event.Event(closed{}))
+		msgs = msgs[:0]
+
+		err = reg.ProcessEvent(sinkAddr, event.Disconnect{})
+		assert.NilError(t, err)
+
+		err = reg.ProcessEvent(sinkAddr, event.Connect{Id: sinkId, Token: sinkToken})
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(msgs), 1)
+		paired, ok := msgs[0].e.(event.Paired)
+		assert.Assert(t, ok)
+		assert.Assert(t, paired.Token != sinkToken)
+		assert.Assert(t, reg.State.Devices[sinkId].Pending)
+	})
+
+	t.Run("unknown device not reset", func(t *testing.T) {
+		err := reg.ResetDevice(uuid.New())
+		assert.ErrorIs(t, err, registry.ErrDeviceNotFound)
+	})
+}
+
+func TestDiscovered(t *testing.T) {
+	sh := mockStateHolder{}
+	reg := registry.New(sh, mockTransport(func(addr string, e event.Event) error {
+		return nil
+	}))
+
+	addr := uuid.New().String()
+	id := uuid.New()
+
+	reg.DeviceDiscovered(registry.DiscoveredDevice{
+		Id:      id,
+		Name:    "sink",
+		Addr:    "192.168.1.2:9",
+		Outputs: 1,
+	})
+
+	t.Run("device listed until it connects", func(t *testing.T) {
+		devs := reg.Discovered()
+		assert.Equal(t, len(devs), 1)
+		assert.Equal(t, devs[0].Name, "sink")
+		assert.Assert(t, !devs[0].LastSeen.IsZero())
+
+		err := reg.ProcessEvent(addr, event.Connect{Id: id})
+		assert.NilError(t, err)
+		assert.Equal(t, len(reg.Discovered()), 0)
+	})
+
+	t.Run("device listed again after it disconnects", func(t *testing.T) {
+		err := reg.ProcessEvent(addr, event.Disconnect{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(reg.Discovered()), 1)
+	})
+
+	t.Run("device no longer seen forgotten", func(t *testing.T) {
+		reg.SetDiscoveredTTL(time.Minute)
+
+		reg.DeviceDiscovered(registry.DiscoveredDevice{
+			Id:       id,
+			Name:     "sink",
+			Addr:     "192.168.1.2:9",
+			LastSeen: time.Now().Add(-2 * time.Minute),
+		})
+		assert.Equal(t, len(reg.Discovered()), 0)
+	})
+}
@@ -1,6 +1,8 @@
 package codec
 
 type Codec[E any] interface {
+	// Name identifies the codec during connection handshakes.
+	Name() string
 	MarshalEvent(e E) ([]byte, error)
 	UnmarshalEvent(b []byte, e *E) error
 }
@@ -15,6 +15,10 @@ func NewGobCodec[E any](types ...any) Codec[E] {
 	return &GobCodec[E]{}
 }
 
+func (m *GobCodec[E]) Name() string {
+	return "gob"
+}
+
 func (m *GobCodec[E]) UnmarshalEvent(b []byte, dest *E) error {
 	r := bytes.NewReader(b)
 	dec := gob.NewDecoder(r)
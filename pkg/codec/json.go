@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// JSONCodec encodes events as a JSON envelope that carries the name of the
+// concrete event type next to its payload, e.g.
+// {"type":"SetInputActive","data":{...}}.
+type JSONCodec[E any] struct {
+	types map[string]reflect.Type
+}
+
+type jsonEnvelope struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func NewJSONCodec[E any](types ...any) Codec[E] {
+	return &JSONCodec[E]{
+		types: typeNames(types),
+	}
+}
+
+func (m *JSONCodec[E]) Name() string {
+	return "json"
+}
+
+func (m *JSONCodec[E]) UnmarshalEvent(b []byte, dest *E) error {
+	var env jsonEnvelope
+	err := json.Unmarshal(b, &env)
+	if err != nil {
+		return err
+	}
+
+	typ, ok := m.types[env.Type]
+	if !ok {
+		return fmt.Errorf("unknown event type %q", env.Type)
+	}
+
+	v := reflect.New(typ)
+	if len(env.Data) > 0 {
+		err = json.Unmarshal(env.Data, v.Interface())
+		if err != nil {
+			return err
+		}
+	}
+
+	e, ok := v.Elem().Interface().(E)
+	if !ok {
+		return fmt.Errorf("invalid event type %q", env.Type)
+	}
+
+	*dest = e
+
+	return nil
+}
+
+func (m *JSONCodec[E]) MarshalEvent(e E) ([]byte, error) {
+	t := reflect.TypeOf(e)
+	if t == nil {
+		return nil, fmt.Errorf("invalid event %v", e)
+	}
+
+	name := t.Name()
+	if _, ok := m.types[name]; !ok {
+		return nil, fmt.Errorf("unregistered event type %T", e)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonEnvelope{
+		Type: name,
+		Data: data,
+	})
+}
+
+// typeNames maps the names of the given named struct types to their
+// reflected types. Unnamed types (e.g. map[string]any) are skipped, as they
+// cannot be addressed from an envelope.
+func typeNames(types []any) map[string]reflect.Type {
+	names := make(map[string]reflect.Type)
+
+	for _, typ := range types {
+		t := reflect.TypeOf(typ)
+		if t.Kind() != reflect.Struct || t.Name() == "" {
+			continue
+		}
+
+		names[t.Name()] = t
+	}
+
+	return names
+}
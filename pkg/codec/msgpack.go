@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackCodec encodes events as a MessagePack envelope that carries the
+// name of the concrete event type next to its payload, mirroring JSONCodec.
+// Struct fields are keyed by their Go names.
+type MsgpackCodec[E any] struct {
+	types map[string]reflect.Type
+}
+
+type msgpackEnvelope struct {
+	Type string             `msgpack:"type"`
+	Data msgpack.RawMessage `msgpack:"data"`
+}
+
+func NewMsgpackCodec[E any](types ...any) Codec[E] {
+	return &MsgpackCodec[E]{
+		types: typeNames(types),
+	}
+}
+
+func (m *MsgpackCodec[E]) Name() string {
+	return "msgpack"
+}
+
+func (m *MsgpackCodec[E]) UnmarshalEvent(b []byte, dest *E) error {
+	var env msgpackEnvelope
+	err := m.decode(b, &env)
+	if err != nil {
+		return err
+	}
+
+	typ, ok := m.types[env.Type]
+	if !ok {
+		return fmt.Errorf("unknown event type %q", env.Type)
+	}
+
+	v := reflect.New(typ)
+	if len(env.Data) > 0 {
+		err = m.decode(env.Data, v.Interface())
+		if err != nil {
+			return err
+		}
+	}
+
+	e, ok := v.Elem().Interface().(E)
+	if !ok {
+		return fmt.Errorf("invalid event type %q", env.Type)
+	}
+
+	*dest = e
+
+	return nil
+}
+
+// decode decodes numbers held by interfaces as int64, uint64 or float64,
+// instead of the smallest type that fits them.
+func (m *MsgpackCodec[E]) decode(b []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.UseLooseInterfaceDecoding(true)
+
+	return dec.Decode(v)
+}
+
+func (m *MsgpackCodec[E]) MarshalEvent(e E) ([]byte, error) {
+	t := reflect.TypeOf(e)
+	if t == nil {
+		return nil, fmt.Errorf("invalid event %v", e)
+	}
+
+	name := t.Name()
+	if _, ok := m.types[name]; !ok {
+		return nil, fmt.Errorf("unregistered event type %T", e)
+	}
+
+	data, err := msgpack.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpack.Marshal(msgpackEnvelope{
+		Type: name,
+		Data: data,
+	})
+}
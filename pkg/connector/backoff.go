@@ -0,0 +1,51 @@
+package connector
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultMinDelay = 100 * time.Millisecond
+	DefaultMaxDelay = 30 * time.Second
+
+	// DefaultMinUptime is how long a connection must stay up before the
+	// backoff is reset.
+	DefaultMinUptime = 5 * time.Second
+)
+
+// Backoff computes exponentially growing delays between attempts. Every
+// delay is jittered to a random value between half and all of the nominal
+// delay, so that devices that lost the registry at the same time do not
+// reconnect in lockstep.
+type Backoff struct {
+	Min      time.Duration
+	Max      time.Duration
+	attempts int
+}
+
+// Next returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	d := b.Min
+	for i := 0; i < b.attempts && d < b.Max; i++ {
+		d *= 2
+	}
+
+	if d > b.Max {
+		d = b.Max
+	}
+
+	b.attempts++
+
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Reset restarts the backoff from the minimum delay.
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
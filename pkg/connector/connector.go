@@ -0,0 +1,135 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Connector keeps a connection to one of a set of addresses. Addresses are
+// tried in the order they were added; once all of them have failed, the
+// connector backs off before trying again.
+type Connector struct {
+	mux       sync.Mutex
+	addrs     []net.Addr
+	added     chan struct{}
+	connect   func(addr net.Addr) error
+	backoff   Backoff
+	minUptime time.Duration
+}
+
+// New creates a connector. connect must dial the given address and block
+// until the connection is closed. It returns an error only if no connection
+// could be established.
+func New(connect func(addr net.Addr) error) *Connector {
+	return &Connector{
+		added:   make(chan struct{}, 1),
+		connect: connect,
+		backoff: Backoff{
+			Min: DefaultMinDelay,
+			Max: DefaultMaxDelay,
+		},
+		minUptime: DefaultMinUptime,
+	}
+}
+
+// SetBackoff sets the minimum and maximum delay between rounds of failed
+// connection attempts.
+func (c *Connector) SetBackoff(min, max time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.backoff.Min = min
+	c.backoff.Max = max
+}
+
+// SetMinUptime sets how long a connection must stay up to count as
+// established. Connections that are closed sooner, e.g. by a peer that
+// refuses them, are retried with backoff.
+func (c *Connector) SetMinUptime(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.minUptime = d
+}
+
+// AddAddr adds an address to connect to. Adding an address cuts short the
+// current backoff delay.
+func (c *Connector) AddAddr(addr net.Addr) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if slices.ContainsFunc(c.addrs, func(a net.Addr) bool {
+		return a.Network() == addr.Network() && a.String() == addr.String()
+	}) {
+		return
+	}
+
+	c.addrs = append(c.addrs, addr)
+
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+}
+
+// Run connects until the context is cancelled. A connection that stayed up
+// for the minimum uptime and was later closed is retried right away, while
+// failed attempts and short-lived connections are retried with exponential
+// backoff.
+func (c *Connector) Run(ctx context.Context) error {
+	for {
+		c.mux.Lock()
+		addrs := slices.Clone(c.addrs)
+		minUptime := c.minUptime
+		c.mux.Unlock()
+
+		var connected bool
+		for _, addr := range addrs {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			fmt.Println("connecting to", addr)
+
+			start := time.Now()
+
+			err := c.connect(addr)
+			if err != nil {
+				fmt.Println("error connecting to", addr, err)
+				continue
+			}
+
+			fmt.Println("disconnected from", addr)
+
+			// a connection that is dropped right away must not make the
+			// connector spin against the peer
+			connected = time.Since(start) >= minUptime
+			break
+		}
+
+		c.mux.Lock()
+		if connected {
+			c.backoff.Reset()
+			c.mux.Unlock()
+			continue
+		}
+
+		delay := c.backoff.Next()
+		c.mux.Unlock()
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-c.added:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
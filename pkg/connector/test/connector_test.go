@@ -0,0 +1,130 @@
+package connector_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/pkg/connector"
+)
+
+func TestBackoff(t *testing.T) {
+	b := connector.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 1 * time.Second,
+	}
+
+	nominal := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		1 * time.Second,
+		1 * time.Second,
+	}
+
+	for _, d := range nominal {
+		got := b.Next()
+		assert.Assert(t, got >= d/2 && got <= d, "delay %s not within [%s, %s]", got, d/2, d)
+	}
+
+	b.Reset()
+
+	got := b.Next()
+	assert.Assert(t, got <= 100*time.Millisecond)
+}
+
+func TestConnector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bad := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	good := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}
+
+	attempts := make(chan net.Addr, 16)
+	sessions := 0
+
+	c := connector.New(func(addr net.Addr) error {
+		attempts <- addr
+
+		if addr.String() == bad.String() {
+			return errors.New("connection refused")
+		}
+
+		sessions++
+		if sessions == 2 {
+			cancel()
+		}
+
+		return nil
+	})
+	c.SetBackoff(10*time.Millisecond, 20*time.Millisecond)
+
+	c.AddAddr(bad)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	t.Run("failed attempts are retried with backoff", func(t *testing.T) {
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, (<-attempts).String(), bad.String())
+		}
+
+		assert.Assert(t, time.Since(start) >= 10*time.Millisecond)
+	})
+
+	c.AddAddr(bad)
+	c.AddAddr(good)
+
+	t.Run("closed connections are retried", func(t *testing.T) {
+		select {
+		case err := <-done:
+			assert.Assert(t, errors.Is(err, context.Canceled))
+		case <-time.After(1 * time.Second):
+			t.Fatal("connector did not stop")
+		}
+
+		assert.Equal(t, sessions, 2)
+	})
+}
+
+func TestConnectorMinUptime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+
+	attempts := make(chan time.Time, 16)
+
+	c := connector.New(func(addr net.Addr) error {
+		attempts <- time.Now()
+
+		// the peer accepts the connection and drops it right away
+		return nil
+	})
+	c.SetBackoff(40*time.Millisecond, 40*time.Millisecond)
+	c.SetMinUptime(time.Second)
+
+	c.AddAddr(addr)
+
+	go func() {
+		_ = c.Run(ctx)
+	}()
+
+	// adding the address cuts the first delay short
+	<-attempts
+
+	prev := <-attempts
+	for i := 0; i < 2; i++ {
+		next := <-attempts
+		assert.Assert(t, next.Sub(prev) >= 20*time.Millisecond, "retried after %s", next.Sub(prev))
+		prev = next
+	}
+}
@@ -0,0 +1,248 @@
+package dataplane
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"ledctl3/pkg/codec"
+)
+
+const (
+	// headerSize is the size of the header that precedes every datagram:
+	// a 4-byte sequence number, a 2-byte fragment index and a 2-byte
+	// fragment count, all little-endian.
+	headerSize = 8
+
+	// maxPayload is the maximum number of event bytes carried by a single
+	// datagram, chosen to stay below common path MTUs.
+	maxPayload = 1200
+
+	// maxFragments bounds the size of an event to maxFragments*maxPayload.
+	maxFragments = 1024
+
+	// maxReorder is the distance after which an old sequence number is no
+	// longer considered late, but a sign that the peer has restarted.
+	maxReorder = 256
+)
+
+// Conn is a UDP channel for realtime events. Events larger than a single
+// datagram are fragmented and reassembled on the receiving end. Every event
+// carries a sequence number, and events older than the last one delivered
+// from the same peer are dropped instead of being delivered late.
+type Conn[E any] struct {
+	mux     sync.Mutex
+	codec   codec.Codec[E]
+	port    int
+	conn    *net.UDPConn
+	handler func(string, E)
+	seqs    map[string]uint32
+	peers   map[string]*peer
+}
+
+type peer struct {
+	// delivered is set once an event has been delivered from the peer, as
+	// the sequence number of the first event is not known in advance.
+	delivered bool
+	last      uint32
+	// seq is the sequence number of the event currently being reassembled.
+	seq   uint32
+	frags [][]byte
+	recv  int
+}
+
+func New[E any](port int, codec codec.Codec[E]) *Conn[E] {
+	return &Conn[E]{
+		port:  port,
+		codec: codec,
+		seqs:  map[string]uint32{},
+		peers: map[string]*peer{},
+	}
+}
+
+func (c *Conn[E]) Start() error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: c.port})
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+
+	go c.processPackets()
+
+	return nil
+}
+
+// Port returns the local port the connection listens on.
+func (c *Conn[E]) Port() int {
+	if c.conn == nil {
+		return c.port
+	}
+
+	return c.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (c *Conn[E]) Stop() {
+	_ = c.conn.Close()
+}
+
+func (c *Conn[E]) processPackets() {
+	buf := make([]byte, headerSize+maxPayload)
+
+	for {
+		n, addr, err := c.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			fmt.Println("error during read: ", err)
+			continue
+		}
+
+		b, ok := c.reassemble(addr.String(), buf[:n])
+		if !ok {
+			continue
+		}
+
+		var e E
+		err = c.codec.UnmarshalEvent(b, &e)
+		if err != nil {
+			fmt.Println("error during unmarshal: ", err)
+			continue
+		}
+
+		if c.handler != nil {
+			c.handler(addr.String(), e)
+		}
+	}
+}
+
+// reassemble buffers the fragment contained in the packet and returns the
+// complete event once all of its fragments have been received.
+func (c *Conn[E]) reassemble(addr string, pkt []byte) ([]byte, bool) {
+	if len(pkt) < headerSize {
+		fmt.Println("invalid packet from", addr)
+		return nil, false
+	}
+
+	seq := binary.LittleEndian.Uint32(pkt[0:4])
+	idx := int(binary.LittleEndian.Uint16(pkt[4:6]))
+	count := int(binary.LittleEndian.Uint16(pkt[6:8]))
+
+	if count == 0 || count > maxFragments || idx >= count {
+		fmt.Println("invalid packet from", addr)
+		return nil, false
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	p, ok := c.peers[addr]
+	if !ok {
+		p = &peer{}
+		c.peers[addr] = p
+	}
+
+	if p.delivered && p.last-seq > maxReorder && seq-p.last > maxReorder {
+		// the peer restarted its sequence numbers
+		*p = peer{}
+	}
+
+	if p.delivered && !newer(seq, p.last) {
+		// late or duplicate event
+		return nil, false
+	}
+
+	if p.frags == nil || seq != p.seq {
+		if p.frags != nil && !newer(seq, p.seq) && p.seq-seq <= maxReorder {
+			// fragment of an event older than the one being reassembled
+			return nil, false
+		}
+
+		// start reassembling a newer event, abandoning any incomplete one
+		p.seq = seq
+		p.frags = make([][]byte, count)
+		p.recv = 0
+	}
+
+	if count != len(p.frags) || p.frags[idx] != nil {
+		return nil, false
+	}
+
+	p.frags[idx] = append([]byte(nil), pkt[headerSize:]...)
+	p.recv++
+
+	if p.recv < len(p.frags) {
+		return nil, false
+	}
+
+	var b []byte
+	for _, frag := range p.frags {
+		b = append(b, frag...)
+	}
+
+	p.delivered = true
+	p.last = seq
+	p.frags = nil
+
+	return b, true
+}
+
+// newer reports whether sequence number a comes after b, taking wraparound
+// into account.
+func newer(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+func (c *Conn[E]) Write(addr string, e E) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	buf, err := c.codec.MarshalEvent(e)
+	if err != nil {
+		fmt.Println("error during marshal: ", err)
+		return err
+	}
+
+	count := (len(buf) + maxPayload - 1) / maxPayload
+	if count == 0 {
+		count = 1
+	}
+
+	if count > maxFragments {
+		return fmt.Errorf("event too large: %d bytes", len(buf))
+	}
+
+	c.mux.Lock()
+	c.seqs[addr]++
+	seq := c.seqs[addr]
+	c.mux.Unlock()
+
+	pkt := make([]byte, headerSize+maxPayload)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * maxPayload
+		if end > len(buf) {
+			end = len(buf)
+		}
+
+		binary.LittleEndian.PutUint32(pkt[0:4], seq)
+		binary.LittleEndian.PutUint16(pkt[4:6], uint16(i))
+		binary.LittleEndian.PutUint16(pkt[6:8], uint16(count))
+		n := copy(pkt[headerSize:], buf[i*maxPayload:end])
+
+		_, err = c.conn.WriteToUDP(pkt[:headerSize+n], udpAddr)
+		if err != nil {
+			fmt.Println("error during write: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Conn[E]) SetMessageHandler(h func(addr string, e E)) {
+	c.handler = h
+}
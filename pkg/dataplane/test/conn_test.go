@@ -0,0 +1,79 @@
+package dataplane_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/pkg/dataplane"
+	"ledctl3/pkg/pixfmt"
+	"ledctl3/pkg/uuid"
+)
+
+func TestConn(t *testing.T) {
+	recv := dataplane.New[event.Event](0, event.Codec)
+
+	events := make(chan event.Event, 10)
+	recv.SetMessageHandler(func(addr string, e event.Event) {
+		events <- e
+	})
+
+	err := recv.Start()
+	assert.NilError(t, err)
+	defer recv.Stop()
+
+	send := dataplane.New[event.Event](0, event.Codec)
+	err = send.Start()
+	assert.NilError(t, err)
+	defer send.Stop()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", recv.Port())
+
+	t.Run("small event", func(t *testing.T) {
+		e := event.Connect{Id: uuid.New()}
+
+		err := send.Write(addr, e)
+		assert.NilError(t, err)
+
+		select {
+		case got := <-events:
+			assert.DeepEqual(t, got, e)
+		case <-time.After(1 * time.Second):
+			t.Fatal("event not received")
+		}
+	})
+
+	t.Run("fragmented event", func(t *testing.T) {
+		pix := make([]byte, 3*3000)
+		for i := range pix {
+			pix[i] = byte(i)
+		}
+
+		e := event.Data{
+			SinkId: uuid.New(),
+			Outputs: []event.DataOutput{
+				{
+					Id: uuid.New(),
+					Frame: pixfmt.Frame{
+						Format: pixfmt.RGB,
+						Key:    1,
+						Pix:    pix,
+					},
+				},
+			},
+		}
+
+		err := send.Write(addr, e)
+		assert.NilError(t, err)
+
+		select {
+		case got := <-events:
+			assert.DeepEqual(t, got, event.Event(e))
+		case <-time.After(1 * time.Second):
+			t.Fatal("event not received")
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultProbePort is the UDP port registries answer probes on.
+	DefaultProbePort = 1339
+
+	// DefaultProbeInterval is the interval between probes while discovering.
+	DefaultProbeInterval = 2 * time.Second
+
+	probeMessage = "LEDCTL DISCOVER"
+	replyPrefix  = "LEDCTL REGISTRY "
+)
+
+type broadcast struct {
+	addr     string
+	interval time.Duration
+}
+
+// Broadcast returns a discovery that periodically sends a probe to the given
+// UDP address, usually the broadcast address of the network and
+// DefaultProbePort. Registries reply with the port they accept devices on.
+func Broadcast(addr string, interval time.Duration) Discovery {
+	return broadcast{
+		addr:     addr,
+		interval: interval,
+	}
+}
+
+func (b broadcast) Discover(ctx context.Context) (<-chan net.Addr, error) {
+	dst, err := net.ResolveUDPAddr("udp4", b.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make(chan net.Addr)
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		for {
+			_, err := conn.WriteToUDP([]byte(probeMessage), dst)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
+				fmt.Println("error sending probe:", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	go func() {
+		defer close(addrs)
+
+		seen := make(map[string]bool)
+		buf := make([]byte, 64)
+
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
+				fmt.Println("error during read: ", err)
+				continue
+			}
+
+			port, ok := parseReply(buf[:n])
+			if !ok {
+				continue
+			}
+
+			addr := &net.TCPAddr{IP: from.IP, Port: port}
+			if seen[addr.String()] {
+				continue
+			}
+
+			seen[addr.String()] = true
+
+			select {
+			case addrs <- addr:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return addrs, nil
+}
+
+func parseReply(b []byte) (int, bool) {
+	s, ok := strings.CutPrefix(string(b), replyPrefix)
+	if !ok {
+		return 0, false
+	}
+
+	port, err := strconv.Atoi(s)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, false
+	}
+
+	return port, true
+}
+
+// Responder answers broadcast probes on behalf of a registry.
+type Responder struct {
+	port         int
+	registryPort int
+	conn         *net.UDPConn
+}
+
+// NewResponder creates a responder that listens for probes on the given UDP
+// port and replies with the port the registry accepts devices on.
+func NewResponder(port, registryPort int) *Responder {
+	return &Responder{
+		port:         port,
+		registryPort: registryPort,
+	}
+}
+
+func (r *Responder) Start() error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: r.port})
+	if err != nil {
+		return err
+	}
+
+	r.conn = conn
+
+	go r.respond()
+
+	return nil
+}
+
+// Port returns the local port the responder listens on.
+func (r *Responder) Port() int {
+	if r.conn == nil {
+		return r.port
+	}
+
+	return r.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (r *Responder) Stop() {
+	_ = r.conn.Close()
+}
+
+func (r *Responder) respond() {
+	reply := []byte(replyPrefix + strconv.Itoa(r.registryPort))
+	buf := make([]byte, 64)
+
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			fmt.Println("error during read: ", err)
+			continue
+		}
+
+		if string(buf[:n]) != probeMessage {
+			continue
+		}
+
+		_, err = r.conn.WriteToUDP(reply, from)
+		if err != nil {
+			fmt.Println("error during write: ", err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Discovery finds the addresses of registries on the network.
+type Discovery interface {
+	// Discover sends the address of every registry that is found until the
+	// context is cancelled or the discovery has nothing more to find, at
+	// which point the channel is closed.
+	Discover(ctx context.Context) (<-chan net.Addr, error)
+}
+
+// DefaultFallbackDelay is how long Chain waits for a discovery to find a
+// registry before it starts the next one.
+const DefaultFallbackDelay = 5 * time.Second
+
+type chain struct {
+	ds    []Discovery
+	delay time.Duration
+}
+
+// Chain runs the given discoveries in order of priority. The next discovery
+// is started only once the previous one has finished, could not be started,
+// or has found nothing within the fallback delay, e.g. when multicast is
+// blocked. A discovery that has found a registry holds back the ones after
+// it until it finishes, so their addresses always come later.
+func Chain(fallbackDelay time.Duration, ds ...Discovery) Discovery {
+	return chain{
+		ds:    ds,
+		delay: fallbackDelay,
+	}
+}
+
+func (c chain) Discover(ctx context.Context) (<-chan net.Addr, error) {
+	addrs := make(chan net.Addr)
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(addrs)
+		}()
+
+		for _, d := range c.ds {
+			found, err := d.Discover(ctx)
+			if err != nil {
+				fmt.Println("error starting discovery:", err)
+				continue
+			}
+
+			next := make(chan struct{})
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				// a discovery that falls back keeps running, in case it
+				// finds a registry later on
+				var once sync.Once
+				fallBack := func() {
+					once.Do(func() { close(next) })
+				}
+				defer fallBack()
+
+				timer := time.NewTimer(c.delay)
+				defer timer.Stop()
+
+				timeout := timer.C
+				for {
+					select {
+					case addr, ok := <-found:
+						if !ok {
+							return
+						}
+
+						timeout = nil
+
+						select {
+						case addrs <- addr:
+						case <-ctx.Done():
+							return
+						}
+					case <-timeout:
+						timeout = nil
+						fallBack()
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			select {
+			case <-next:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return addrs, nil
+}
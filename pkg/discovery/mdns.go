@@ -0,0 +1,56 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"ledctl3/pkg/mdns"
+)
+
+type mdnsDiscovery struct {
+	versionCheck func(version string) error
+}
+
+// MDNS returns a discovery that looks up the registry over zeroconf.
+// Registries that advertise a protocol version rejected by versionCheck are
+// skipped; a nil versionCheck accepts every registry.
+func MDNS(versionCheck func(version string) error) Discovery {
+	return mdnsDiscovery{
+		versionCheck: versionCheck,
+	}
+}
+
+func (d mdnsDiscovery) Discover(ctx context.Context) (<-chan net.Addr, error) {
+	addrs := make(chan net.Addr)
+
+	go func() {
+		defer close(addrs)
+
+		// the resolver retries until multicast is available, which must not
+		// hold up other discoveries
+		r := mdns.NewResolver()
+		r.SetVersionCheck(d.versionCheck)
+
+		found, err := r.Lookup(ctx)
+		if err != nil {
+			fmt.Println("error during mdns lookup:", err)
+			return
+		}
+
+		for {
+			select {
+			case addr := <-found:
+				select {
+				case addrs <- addr:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return addrs, nil
+}
@@ -0,0 +1,44 @@
+package discovery
+
+import (
+	"context"
+	"net"
+)
+
+type static struct {
+	addrs []string
+}
+
+// Static returns a discovery for a fixed list of host:port addresses, e.g.
+// from a config file.
+func Static(addrs ...string) Discovery {
+	return static{addrs: addrs}
+}
+
+func (s static) Discover(ctx context.Context) (<-chan net.Addr, error) {
+	var resolved []net.Addr
+	for _, a := range s.addrs {
+		addr, err := net.ResolveTCPAddr("tcp", a)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved = append(resolved, addr)
+	}
+
+	addrs := make(chan net.Addr)
+
+	go func() {
+		defer close(addrs)
+
+		for _, addr := range resolved {
+			select {
+			case addrs <- addr:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return addrs, nil
+}
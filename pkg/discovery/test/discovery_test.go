@@ -0,0 +1,144 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/pkg/discovery"
+)
+
+type failing struct{}
+
+func (failing) Discover(context.Context) (<-chan net.Addr, error) {
+	return nil, errors.New("multicast unavailable")
+}
+
+func collect(t *testing.T, addrs <-chan net.Addr, n int) []string {
+	t.Helper()
+
+	var got []string
+	for len(got) < n {
+		select {
+		case addr, ok := <-addrs:
+			if !ok {
+				return got
+			}
+
+			got = append(got, addr.String())
+		case <-time.After(1 * time.Second):
+			t.Fatal("address not discovered")
+		}
+	}
+
+	return got
+}
+
+func TestStatic(t *testing.T) {
+	addrs, err := discovery.Static("127.0.0.1:1337", "127.0.0.2:1337").Discover(context.Background())
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, collect(t, addrs, 3), []string{"127.0.0.1:1337", "127.0.0.2:1337"})
+
+	t.Run("invalid address", func(t *testing.T) {
+		_, err := discovery.Static("invalid").Discover(context.Background())
+		assert.ErrorContains(t, err, "missing port")
+	})
+}
+
+// silent finds nothing until the context is cancelled, like a lookup on a
+// network that drops multicast.
+type silent struct{}
+
+func (silent) Discover(ctx context.Context) (<-chan net.Addr, error) {
+	addrs := make(chan net.Addr)
+
+	go func() {
+		<-ctx.Done()
+		close(addrs)
+	}()
+
+	return addrs, nil
+}
+
+func TestChain(t *testing.T) {
+	t.Run("failing discovery skipped", func(t *testing.T) {
+		d := discovery.Chain(time.Minute,
+			failing{},
+			discovery.Static("127.0.0.1:1337"),
+		)
+
+		addrs, err := d.Discover(context.Background())
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, collect(t, addrs, 2), []string{"127.0.0.1:1337"})
+	})
+
+	t.Run("addresses in order of the discoveries", func(t *testing.T) {
+		d := discovery.Chain(time.Minute,
+			discovery.Static("127.0.0.1:1337", "127.0.0.2:1337"),
+			discovery.Static("127.0.0.3:1337"),
+		)
+
+		addrs, err := d.Discover(context.Background())
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, collect(t, addrs, 4), []string{"127.0.0.1:1337", "127.0.0.2:1337", "127.0.0.3:1337"})
+	})
+
+	t.Run("fallback after the delay", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d := discovery.Chain(10*time.Millisecond,
+			silent{},
+			discovery.Static("127.0.0.1:1337"),
+		)
+
+		addrs, err := d.Discover(ctx)
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, collect(t, addrs, 1), []string{"127.0.0.1:1337"})
+
+		cancel()
+
+		select {
+		case _, ok := <-addrs:
+			assert.Assert(t, !ok)
+		case <-time.After(1 * time.Second):
+			t.Fatal("channel not closed")
+		}
+	})
+}
+
+func TestBroadcast(t *testing.T) {
+	r := discovery.NewResponder(0, 1337)
+	assert.NilError(t, r.Start())
+	defer r.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := discovery.Broadcast(fmt.Sprintf("127.0.0.1:%d", r.Port()), 10*time.Millisecond)
+
+	addrs, err := d.Discover(ctx)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, collect(t, addrs, 1), []string{"127.0.0.1:1337"})
+
+	t.Run("closed when cancelled", func(t *testing.T) {
+		cancel()
+
+		select {
+		case _, ok := <-addrs:
+			assert.Assert(t, !ok)
+		case <-time.After(1 * time.Second):
+			t.Fatal("channel not closed")
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package eventlog
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// queueSize is the number of entries a writer buffers before it starts
+// dropping data entries.
+const queueSize = 4096
+
+var ErrClosed = errors.New("event log closed")
+
+// Kind tells what happened on a connection.
+type Kind uint8
+
+const (
+	KindEvent Kind = iota
+	KindConnect
+	KindDisconnect
+	// KindData is an event of the realtime data plane.
+	KindData
+)
+
+// Direction tells whether an event was received from or sent to the peer.
+type Direction string
+
+const (
+	In  Direction = "in"
+	Out Direction = "out"
+)
+
+// Entry is a single record of an event log. Event is only set for entries
+// of KindEvent and KindData. Event types must be registered with gob, which the event
+// package does for every event it defines.
+type Entry[E any] struct {
+	Time      time.Time
+	Kind      Kind
+	Addr      string
+	Direction Direction
+	Event     E
+}
+
+// Writer appends entries to a log file as a single gob stream. Entries are
+// queued and encoded in the background, so that recording does not block the
+// component being recorded on the disk. If the queue is full, entries of
+// KindData are dropped and the number of dropped entries is reported, while
+// the rarer control entries wait for room, so that a replay sees every one
+// of them.
+type Writer[E any] struct {
+	mux     sync.Mutex
+	closed  bool
+	dropped int
+	sending sync.WaitGroup
+	queue   chan Entry[E]
+	done    chan error
+	f       *os.File
+	w       *bufio.Writer
+	enc     *gob.Encoder
+}
+
+// Create creates a log file at path, truncating it if it already exists.
+func Create[E any](path string) (*Writer[E], error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(f)
+
+	wr := &Writer[E]{
+		queue: make(chan Entry[E], queueSize),
+		done:  make(chan error, 1),
+		f:     f,
+		w:     w,
+		enc:   gob.NewEncoder(w),
+	}
+
+	go wr.run()
+
+	return wr, nil
+}
+
+// Write queues an entry to be appended to the log.
+func (w *Writer[E]) Write(e Entry[E]) error {
+	w.mux.Lock()
+
+	if w.closed {
+		w.mux.Unlock()
+		return ErrClosed
+	}
+
+	if e.Kind == KindData {
+		select {
+		case w.queue <- e:
+		default:
+			w.dropped++
+		}
+
+		w.mux.Unlock()
+		return nil
+	}
+
+	// wait for room without holding up the encoder, which takes the lock
+	// to report dropped entries; Close waits for the entry to be queued
+	w.sending.Add(1)
+	w.mux.Unlock()
+
+	w.queue <- e
+	w.sending.Done()
+
+	return nil
+}
+
+// run encodes queued entries until the writer is closed. The log is flushed
+// whenever the queue runs empty, so that it is usable even if the process
+// crashes.
+func (w *Writer[E]) run() {
+	var err error
+
+	for e := range w.queue {
+		if err != nil {
+			continue
+		}
+
+		err = w.enc.Encode(&e)
+		if err != nil {
+			fmt.Println("error writing event log:", err)
+			continue
+		}
+
+		if len(w.queue) > 0 {
+			continue
+		}
+
+		w.mux.Lock()
+		dropped := w.dropped
+		w.dropped = 0
+		w.mux.Unlock()
+
+		if dropped > 0 {
+			fmt.Printf("event log: dropped %d entries\n", dropped)
+		}
+
+		err = w.w.Flush()
+		if err != nil {
+			fmt.Println("error writing event log:", err)
+		}
+	}
+
+	if err == nil {
+		err = w.w.Flush()
+	}
+
+	w.done <- err
+}
+
+// Close writes the queued entries and closes the log file.
+func (w *Writer[E]) Close() error {
+	w.mux.Lock()
+	if w.closed {
+		w.mux.Unlock()
+		return ErrClosed
+	}
+
+	w.closed = true
+	w.mux.Unlock()
+
+	w.sending.Wait()
+	close(w.queue)
+
+	err := <-w.done
+	if err != nil {
+		_ = w.f.Close()
+		return err
+	}
+
+	return w.f.Close()
+}
+
+// Reader reads the entries of a log file in order.
+type Reader[E any] struct {
+	f   *os.File
+	dec *gob.Decoder
+}
+
+func Open[E any](path string) (*Reader[E], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader[E]{
+		f:   f,
+		dec: gob.NewDecoder(bufio.NewReader(f)),
+	}, nil
+}
+
+// Read returns the next entry of the log, or io.EOF once every entry has
+// been read. A log cut short by a crash ends with its last complete entry.
+func (r *Reader[E]) Read() (Entry[E], error) {
+	var e Entry[E]
+	err := r.dec.Decode(&e)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return Entry[E]{}, io.EOF
+	} else if err != nil {
+		return Entry[E]{}, err
+	}
+
+	return e, nil
+}
+
+func (r *Reader[E]) Close() error {
+	return r.f.Close()
+}
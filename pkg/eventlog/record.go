@@ -0,0 +1,99 @@
+package eventlog
+
+import (
+	"fmt"
+	"time"
+
+	"ledctl3/pkg/transport"
+)
+
+// Recorder is a transport that logs every connection, disconnection and
+// event passing through the transport it wraps.
+type Recorder[E any] struct {
+	transport.Transport[E]
+	w                 *Writer[E]
+	handler           func(string, E)
+	connectHandler    func(string)
+	disconnectHandler func(string)
+}
+
+// Record wraps t so that everything passing through it is written to w.
+// Connections are recorded even if no connect handler is set.
+func Record[E any](t transport.Transport[E], w *Writer[E]) *Recorder[E] {
+	r := &Recorder[E]{
+		Transport: t,
+		w:         w,
+	}
+
+	t.SetMessageHandler(func(addr string, e E) {
+		r.record(Entry[E]{Kind: KindEvent, Addr: addr, Direction: In, Event: e})
+
+		if r.handler != nil {
+			r.handler(addr, e)
+		}
+	})
+
+	t.SetConnectHandler(func(addr string) {
+		r.record(Entry[E]{Kind: KindConnect, Addr: addr, Direction: In})
+
+		if r.connectHandler != nil {
+			r.connectHandler(addr)
+		}
+	})
+
+	t.SetDisconnectHandler(func(addr string) {
+		r.record(Entry[E]{Kind: KindDisconnect, Addr: addr, Direction: In})
+
+		if r.disconnectHandler != nil {
+			r.disconnectHandler(addr)
+		}
+	})
+
+	return r
+}
+
+func (r *Recorder[E]) record(e Entry[E]) {
+	e.Time = time.Now()
+
+	err := r.w.Write(e)
+	if err != nil {
+		fmt.Println("error recording event:", err)
+	}
+}
+
+func (r *Recorder[E]) Write(addr string, e E) error {
+	r.record(Entry[E]{Kind: KindEvent, Addr: addr, Direction: Out, Event: e})
+
+	return r.Transport.Write(addr, e)
+}
+
+// RecordData wraps the message handler and write function of a data plane,
+// so that the data passing through it is recorded along with the events of
+// the transport.
+func (r *Recorder[E]) RecordData(h func(addr string, e E), write func(addr string, e E) error) (func(addr string, e E), func(addr string, e E) error) {
+	handler := func(addr string, e E) {
+		r.record(Entry[E]{Kind: KindData, Addr: addr, Direction: In, Event: e})
+
+		h(addr, e)
+	}
+
+	writer := func(addr string, e E) error {
+		r.record(Entry[E]{Kind: KindData, Addr: addr, Direction: Out, Event: e})
+
+		return write(addr, e)
+	}
+
+	return handler, writer
+}
+
+func (r *Recorder[E]) SetMessageHandler(h func(addr string, e E)) {
+	r.handler = h
+}
+
+func (r *Recorder[E]) SetConnectHandler(h func(addr string)) {
+	r.connectHandler = h
+}
+
+func (r *Recorder[E]) SetDisconnectHandler(h func(addr string)) {
+	r.disconnectHandler = h
+}
@@ -0,0 +1,115 @@
+package eventlog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Replayer is a transport that plays back the connections and inbound events
+// of a log, so that a registry or device can be driven exactly like it was
+// when the log was recorded. Events written by the replayed component are
+// discarded.
+type Replayer[E any] struct {
+	r                 *Reader[E]
+	handler           func(string, E)
+	dataHandler       func(string, E)
+	connectHandler    func(string)
+	disconnectHandler func(string)
+}
+
+func NewReplayer[E any](r *Reader[E]) *Replayer[E] {
+	return &Replayer[E]{
+		r: r,
+	}
+}
+
+// Run plays back the log until it ends or ctx is done. Entries are spaced
+// out like they were recorded, sped up by the given factor. A speed of zero
+// plays back the log as fast as possible.
+func (p *Replayer[E]) Run(ctx context.Context, speed float64) error {
+	var last time.Time
+
+	for {
+		e, err := p.r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if e.Direction == Out {
+			continue
+		}
+
+		if speed > 0 && !last.IsZero() {
+			d := time.Duration(float64(e.Time.Sub(last)) / speed)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		last = e.Time
+
+		switch e.Kind {
+		case KindEvent:
+			if p.handler != nil {
+				p.handler(e.Addr, e.Event)
+			}
+		case KindData:
+			if p.dataHandler != nil {
+				p.dataHandler(e.Addr, e.Event)
+			}
+		case KindConnect:
+			if p.connectHandler != nil {
+				p.connectHandler(e.Addr)
+			}
+		case KindDisconnect:
+			if p.disconnectHandler != nil {
+				p.disconnectHandler(e.Addr)
+			}
+		}
+	}
+}
+
+// Start does nothing, as connections are played back by Run.
+func (p *Replayer[E]) Start() error {
+	return nil
+}
+
+func (p *Replayer[E]) Dial(addr string) error {
+	return errors.New("dial not supported during replay")
+}
+
+func (p *Replayer[E]) Write(addr string, e E) error {
+	return nil
+}
+
+// Close does nothing, as connections are played back by Run.
+func (p *Replayer[E]) Close(addr string) error {
+	return nil
+}
+
+func (p *Replayer[E]) SetMessageHandler(h func(addr string, e E)) {
+	p.handler = h
+}
+
+// SetDataHandler sets the handler recorded data plane events are played back
+// to.
+func (p *Replayer[E]) SetDataHandler(h func(addr string, e E)) {
+	p.dataHandler = h
+}
+
+func (p *Replayer[E]) SetConnectHandler(h func(addr string)) {
+	p.connectHandler = h
+}
+
+func (p *Replayer[E]) SetDisconnectHandler(h func(addr string)) {
+	p.disconnectHandler = h
+}
@@ -0,0 +1,214 @@
+package eventlog_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/internal/registry"
+	"ledctl3/pkg/eventlog"
+	"ledctl3/pkg/memserver"
+	"ledctl3/pkg/uuid"
+)
+
+type mockStateHolder struct{}
+
+func (m mockStateHolder) SetState(state registry.State) error {
+	return nil
+}
+
+func (m mockStateHolder) GetState() (registry.State, error) {
+	return registry.State{}, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	w, err := eventlog.Create[event.Event](path)
+	assert.NilError(t, err)
+
+	network := memserver.NewNetwork[event.Event]()
+	rec := eventlog.Record[event.Event](network.New("registry"), w)
+
+	msgs := make(chan event.Event, 1)
+	rec.SetMessageHandler(func(addr string, e event.Event) {
+		msgs <- e
+	})
+
+	disconnected := make(chan string, 1)
+	rec.SetDisconnectHandler(func(addr string) {
+		disconnected <- addr
+	})
+
+	assert.NilError(t, rec.Start())
+
+	dev := network.New("device")
+	c, err := dev.Connect("registry")
+	assert.NilError(t, err)
+	go dev.ProcessEvents("registry", c)
+
+	id := uuid.New()
+	connect := event.Connect{Id: id, Version: event.ProtocolVersion}
+	assert.NilError(t, dev.Write("registry", connect))
+
+	select {
+	case <-msgs:
+	case <-time.After(1 * time.Second):
+		t.Fatal("event not received")
+	}
+
+	ack := event.Ack{RequestId: uuid.New()}
+	assert.NilError(t, rec.Write("device", ack))
+	assert.NilError(t, c.Close())
+
+	select {
+	case <-disconnected:
+	case <-time.After(1 * time.Second):
+		t.Fatal("disconnect not received")
+	}
+
+	assert.NilError(t, w.Close())
+
+	t.Run("entries are recorded in order", func(t *testing.T) {
+		r, err := eventlog.Open[event.Event](path)
+		assert.NilError(t, err)
+		defer r.Close()
+
+		want := []eventlog.Entry[event.Event]{
+			{Kind: eventlog.KindConnect, Addr: "device", Direction: eventlog.In},
+			{Kind: eventlog.KindEvent, Addr: "device", Direction: eventlog.In, Event: connect},
+			{Kind: eventlog.KindEvent, Addr: "device", Direction: eventlog.Out, Event: ack},
+			{Kind: eventlog.KindDisconnect, Addr: "device", Direction: eventlog.In},
+		}
+
+		for _, want := range want {
+			got, err := r.Read()
+			assert.NilError(t, err)
+			assert.Assert(t, !got.Time.IsZero())
+
+			got.Time = time.Time{}
+			assert.DeepEqual(t, got, want)
+		}
+
+		_, err = r.Read()
+		assert.ErrorContains(t, err, "EOF")
+	})
+
+	t.Run("replay drives the registry", func(t *testing.T) {
+		r, err := eventlog.Open[event.Event](path)
+		assert.NilError(t, err)
+		defer r.Close()
+
+		p := eventlog.NewReplayer(r)
+		reg := registry.New(mockStateHolder{}, p)
+
+		assert.NilError(t, p.Run(context.Background(), 0))
+
+		dev, ok := reg.State.Devices[id]
+		assert.Assert(t, ok)
+		assert.Equal(t, dev.Connected, false)
+	})
+}
+
+func TestRecordData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	w, err := eventlog.Create[event.Event](path)
+	assert.NilError(t, err)
+
+	network := memserver.NewNetwork[event.Event]()
+	rec := eventlog.Record[event.Event](network.New("registry"), w)
+
+	var recv []event.Event
+	handler, write := rec.RecordData(func(addr string, e event.Event) {
+		recv = append(recv, e)
+	}, func(addr string, e event.Event) error {
+		return nil
+	})
+
+	in := event.Data{SinkId: uuid.New()}
+	out := event.Data{SinkId: uuid.New()}
+
+	handler("device", in)
+	assert.NilError(t, write("device", out))
+	assert.DeepEqual(t, recv, []event.Event{in})
+
+	assert.NilError(t, w.Close())
+
+	t.Run("data is recorded", func(t *testing.T) {
+		r, err := eventlog.Open[event.Event](path)
+		assert.NilError(t, err)
+		defer r.Close()
+
+		want := []eventlog.Entry[event.Event]{
+			{Kind: eventlog.KindData, Addr: "device", Direction: eventlog.In, Event: in},
+			{Kind: eventlog.KindData, Addr: "device", Direction: eventlog.Out, Event: out},
+		}
+
+		for _, want := range want {
+			got, err := r.Read()
+			assert.NilError(t, err)
+
+			got.Time = time.Time{}
+			assert.DeepEqual(t, got, want)
+		}
+	})
+
+	t.Run("data is replayed", func(t *testing.T) {
+		r, err := eventlog.Open[event.Event](path)
+		assert.NilError(t, err)
+		defer r.Close()
+
+		p := eventlog.NewReplayer(r)
+
+		var data []event.Event
+		p.SetDataHandler(func(addr string, e event.Event) {
+			data = append(data, e)
+		})
+
+		assert.NilError(t, p.Run(context.Background(), 0))
+		assert.DeepEqual(t, data, []event.Event{in})
+	})
+}
+
+func TestWriterFull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	w, err := eventlog.Create[event.Event](path)
+	assert.NilError(t, err)
+
+	// far more entries than the writer queues, written faster than they
+	// are encoded
+	const n = 20000
+	for i := 0; i < n; i++ {
+		assert.NilError(t, w.Write(eventlog.Entry[event.Event]{
+			Kind:  eventlog.KindEvent,
+			Addr:  "device",
+			Event: event.Ack{RequestId: uuid.New()},
+		}))
+	}
+
+	assert.NilError(t, w.Close())
+
+	r, err := eventlog.Open[event.Event](path)
+	assert.NilError(t, err)
+	defer r.Close()
+
+	var read int
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		assert.NilError(t, err)
+		read++
+	}
+
+	assert.Equal(t, read, n)
+}
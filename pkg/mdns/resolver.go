@@ -2,16 +2,22 @@ package mdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grandcat/zeroconf"
+
+	"ledctl3/pkg/uuid"
 )
 
 type Resolver struct {
-	resolver    *zeroconf.Resolver
-	serviceName string
+	resolver     *zeroconf.Resolver
+	serviceName  string
+	versionCheck func(version string) error
 }
 
 func NewResolver() *Resolver {
@@ -35,15 +41,52 @@ func NewResolver() *Resolver {
 
 type OnRegistryFound func(addr net.Addr)
 
+// SetVersionCheck sets a function that Lookup checks the protocol version a
+// registry advertises in its "v" TXT record against. Registries whose version
+// is rejected are skipped.
+func (r *Resolver) SetVersionCheck(check func(version string) error) {
+	r.versionCheck = check
+}
+
+// deviceServiceName is the service devices are advertised under.
+const deviceServiceName = "ledctl-device"
+
+// Device is a device advertised on the network, as parsed from the TXT
+// records of its service: id, name, inputs, outputs and listen.
 type Device struct {
-	Addr net.Addr
+	Addr    net.Addr
+	Id      uuid.UUID
+	Name    string
+	Inputs  int
+	Outputs int
+	// Listening is set if the device accepts connections on Addr.
+	Listening bool
 }
 
-func (r *Resolver) Browse(ctx context.Context) (<-chan net.Addr, error) {
-	devs := make(chan net.Addr)
+// DeviceText returns the TXT records that advertise a device. The address of
+// the device is ignored.
+func DeviceText(dev Device) []string {
+	txt := []string{
+		"id=" + dev.Id.String(),
+		"name=" + dev.Name,
+		"inputs=" + strconv.Itoa(dev.Inputs),
+		"outputs=" + strconv.Itoa(dev.Outputs),
+	}
+
+	if dev.Listening {
+		txt = append(txt, "listen=1")
+	}
+
+	return txt
+}
+
+// Browse sends every device advertised on the network, and again whenever
+// its advertisement changes, until the context is cancelled.
+func (r *Resolver) Browse(ctx context.Context) (<-chan Device, error) {
+	devs := make(chan Device)
 	entries := make(chan *zeroconf.ServiceEntry, 10)
 
-	service := fmt.Sprintf("_%s._tcp", r.serviceName)
+	service := fmt.Sprintf("_%s._tcp", deviceServiceName)
 
 	err := r.resolver.Browse(ctx, service, "local", entries)
 	if err != nil {
@@ -51,28 +94,19 @@ func (r *Resolver) Browse(ctx context.Context) (<-chan net.Addr, error) {
 	}
 
 	go func(entries chan *zeroconf.ServiceEntry) {
+		defer close(devs)
+
 		for e := range entries {
-			for _, ip := range e.AddrIPv4 {
-				fmt.Println(ip, ip.IsPrivate())
-				//var priv bool
-				//for _, ipNet := range PrivateIPNetworks {
-				//	if ipNet.Contains(ip) {
-				//		priv = true
-				//		break
-				//	}
-				//}
-				//
-				//if !priv {
-				//	continue
-				//}
-				//
-				//addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", ip, e.Port))
-				//if err != nil {
-				//	fmt.Print("failed to resolve tcp address: ", err)
-				//	break
-				//}
-				//
-				//devs <- addr
+			dev, err := parseDevice(e)
+			if err != nil {
+				fmt.Println("invalid device advertisement:", e.Instance, err)
+				continue
+			}
+
+			select {
+			case devs <- dev:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}(entries)
@@ -80,6 +114,58 @@ func (r *Resolver) Browse(ctx context.Context) (<-chan net.Addr, error) {
 	return devs, nil
 }
 
+// textValue returns the value of the TXT record with the given key, or an
+// empty string if there is none.
+func textValue(txt []string, key string) string {
+	for _, kv := range txt {
+		k, v, _ := strings.Cut(kv, "=")
+		if k == key {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func parseDevice(e *zeroconf.ServiceEntry) (Device, error) {
+	txt := make(map[string]string)
+	for _, kv := range e.Text {
+		k, v, _ := strings.Cut(kv, "=")
+		txt[k] = v
+	}
+
+	id, err := uuid.Parse(txt["id"])
+	if err != nil {
+		return Device{}, err
+	}
+
+	dev := Device{
+		Id:        id,
+		Name:      txt["name"],
+		Listening: txt["listen"] == "1",
+	}
+
+	// counts are informational, so malformed ones are ignored
+	dev.Inputs, _ = strconv.Atoi(txt["inputs"])
+	dev.Outputs, _ = strconv.Atoi(txt["outputs"])
+
+	ips := append(append([]net.IP{}, e.AddrIPv4...), e.AddrIPv6...)
+	for _, ip := range ips {
+		if !ip.IsPrivate() {
+			continue
+		}
+
+		dev.Addr = &net.TCPAddr{IP: ip, Port: e.Port}
+		break
+	}
+
+	if dev.Addr == nil {
+		return Device{}, errors.New("no private address")
+	}
+
+	return dev, nil
+}
+
 func (r *Resolver) Lookup(ctx context.Context) (chan net.Addr, error) {
 	service := fmt.Sprintf("_%s._tcp", r.serviceName)
 	entries := make(chan *zeroconf.ServiceEntry)
@@ -92,6 +178,14 @@ func (r *Resolver) Lookup(ctx context.Context) (chan net.Addr, error) {
 
 	go func() {
 		for e := range entries {
+			if r.versionCheck != nil {
+				err := r.versionCheck(textValue(e.Text, "v"))
+				if err != nil {
+					fmt.Println("skipping registry", e.Instance, err)
+					continue
+				}
+			}
+
 			for _, ip := range e.AddrIPv4 {
 				if !ip.IsPrivate() {
 					continue
@@ -2,28 +2,46 @@ package mdns
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/grandcat/zeroconf"
 )
 
 type Server struct {
+	mux         sync.Mutex
 	server      *zeroconf.Server
 	serviceName string
 	instance    string
 	port        int
+	txt         []string
 }
 
-func NewServer(instance string, port int) (*Server, error) {
+func NewServer(instance string, port int, txt ...string) (*Server, error) {
 	return &Server{
 		instance:    instance,
 		serviceName: "ledctl",
 		port:        port,
+		txt:         txt,
+	}, nil
+}
+
+// NewDeviceServer advertises a device, see Resolver.Browse. The instance is
+// the device id.
+func NewDeviceServer(instance string, port int, txt ...string) (*Server, error) {
+	return &Server{
+		instance:    instance,
+		serviceName: deviceServiceName,
+		port:        port,
+		txt:         txt,
 	}, nil
 }
 
 func (s *Server) Start() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	service := fmt.Sprintf("_%s._tcp", s.serviceName)
-	zs, err := zeroconf.Register(s.instance, service, "local", s.port, []string{"v=0.0.1"}, nil)
+	zs, err := zeroconf.Register(s.instance, service, "local", s.port, s.txt, nil)
 	if err != nil {
 		return err
 	}
@@ -32,6 +50,18 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// SetText replaces the TXT records of a started server.
+func (s *Server) SetText(txt ...string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.txt = txt
+
+	if s.server != nil {
+		s.server.SetText(txt)
+	}
+}
+
 func (s *Server) Close() error {
 	if s.server != nil {
 		s.server.Shutdown()
@@ -0,0 +1,302 @@
+package memserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Network connects servers that run in the same process. Events are handed
+// over as is, without serialization, so senders must not modify an event
+// after writing it.
+type Network[E any] struct {
+	mux     sync.Mutex
+	servers map[string]*Server[E]
+}
+
+func NewNetwork[E any]() *Network[E] {
+	return &Network[E]{
+		servers: map[string]*Server[E]{},
+	}
+}
+
+// Server is an in-process counterpart of netserver.Server. Every server has
+// a unique address on its network, which peers use to connect and write to
+// it.
+type Server[E any] struct {
+	mux               sync.Mutex
+	network           *Network[E]
+	addr              string
+	listening         bool
+	handler           func(string, E)
+	conns             map[string]*Conn[E]
+	connectHandler    func(string)
+	disconnectHandler func(string)
+}
+
+// New creates a server with the given address on the network.
+func (n *Network[E]) New(addr string) *Server[E] {
+	return &Server[E]{
+		network: n,
+		addr:    addr,
+		conns:   map[string]*Conn[E]{},
+	}
+}
+
+// Addr returns the address of the server on its network.
+func (s *Server[E]) Addr() string {
+	return s.addr
+}
+
+// Start accepts connections from other servers on the network.
+func (s *Server[E]) Start() error {
+	s.network.mux.Lock()
+	defer s.network.mux.Unlock()
+
+	if _, ok := s.network.servers[s.addr]; ok {
+		return fmt.Errorf("address %s already in use", s.addr)
+	}
+
+	s.network.servers[s.addr] = s
+
+	s.mux.Lock()
+	s.listening = true
+	s.mux.Unlock()
+
+	return nil
+}
+
+// Stop stops accepting connections and closes every open connection.
+func (s *Server[E]) Stop() {
+	s.network.mux.Lock()
+	delete(s.network.servers, s.addr)
+	s.network.mux.Unlock()
+
+	s.mux.Lock()
+	s.listening = false
+	conns := make([]*Conn[E], 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mux.Unlock()
+
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// Connect connects to the server with the given address. The connection is
+// served by calling ProcessEvents, like a dialed netserver connection.
+func (s *Server[E]) Connect(addr string) (*Conn[E], error) {
+	s.network.mux.Lock()
+	peer, ok := s.network.servers[addr]
+	s.network.mux.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("connection refused: %s", addr)
+	}
+
+	local, remote := pipe[E]()
+
+	peer.mux.Lock()
+	if !peer.listening {
+		peer.mux.Unlock()
+		return nil, fmt.Errorf("connection refused: %s", addr)
+	}
+
+	if _, ok := peer.conns[s.addr]; ok {
+		peer.mux.Unlock()
+		return nil, fmt.Errorf("already connected: %s", addr)
+	}
+
+	peer.conns[s.addr] = remote
+	peer.mux.Unlock()
+
+	s.mux.Lock()
+	s.conns[addr] = local
+	s.mux.Unlock()
+
+	go peer.ProcessEvents(s.addr, remote)
+
+	return local, nil
+}
+
+// Dial connects to the server with the given address and processes its
+// events until the connection is closed.
+func (s *Server[E]) Dial(addr string) error {
+	c, err := s.Connect(addr)
+	if err != nil {
+		return err
+	}
+
+	s.ProcessEvents(addr, c)
+
+	return nil
+}
+
+// ProcessEvents delivers the events received on the connection to the
+// message handler until the connection is closed.
+func (s *Server[E]) ProcessEvents(addr string, c *Conn[E]) {
+	if s.disconnectHandler != nil {
+		defer func() {
+			s.disconnectHandler(addr)
+		}()
+	}
+
+	if s.connectHandler != nil {
+		s.connectHandler(addr)
+	}
+
+	defer func() {
+		s.mux.Lock()
+		if s.conns[addr] == c {
+			delete(s.conns, addr)
+		}
+		s.mux.Unlock()
+	}()
+
+	for {
+		e, ok := c.pop()
+		if !ok {
+			return
+		}
+
+		if s.handler != nil {
+			s.handler(addr, e)
+		}
+	}
+}
+
+func (s *Server[E]) Write(addr string, e E) error {
+	s.mux.Lock()
+	c, ok := s.conns[addr]
+	s.mux.Unlock()
+
+	if !ok {
+		return io.ErrClosedPipe
+	}
+
+	return c.peer.push(e)
+}
+
+func (s *Server[E]) Close(addr string) error {
+	s.mux.Lock()
+	c, ok := s.conns[addr]
+	s.mux.Unlock()
+
+	if !ok {
+		return io.ErrClosedPipe
+	}
+
+	c.shutdown()
+	c.peer.shutdown()
+
+	return nil
+}
+
+func (s *Server[E]) SetMessageHandler(h func(addr string, e E)) {
+	s.handler = h
+}
+
+func (s *Server[E]) SetConnectHandler(h func(addr string)) {
+	s.connectHandler = h
+}
+
+func (s *Server[E]) SetDisconnectHandler(h func(addr string)) {
+	s.disconnectHandler = h
+}
+
+// Conn is one end of an in-process connection. Events written to a
+// connection are queued without bound, so that writers never block on a
+// peer that is busy writing back.
+type Conn[E any] struct {
+	mux    sync.Mutex
+	cond   *sync.Cond
+	queue  []E
+	closed bool
+	// draining is set once the connection is to be closed after the
+	// queued events have been delivered.
+	draining bool
+	peer     *Conn[E]
+}
+
+func pipe[E any]() (*Conn[E], *Conn[E]) {
+	a, b := &Conn[E]{}, &Conn[E]{}
+	a.cond = sync.NewCond(&a.mux)
+	b.cond = sync.NewCond(&b.mux)
+	a.peer, b.peer = b, a
+
+	return a, b
+}
+
+func (c *Conn[E]) push(e E) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed || c.draining {
+		return io.ErrClosedPipe
+	}
+
+	c.queue = append(c.queue, e)
+	c.cond.Signal()
+
+	return nil
+}
+
+// pop returns the next queued event, blocking until one is available. It
+// returns false once the connection is closed, or once it is draining and
+// every queued event was delivered.
+func (c *Conn[E]) pop() (E, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for len(c.queue) == 0 && !c.closed && !c.draining {
+		c.cond.Wait()
+	}
+
+	if c.closed || len(c.queue) == 0 {
+		var e E
+		return e, false
+	}
+
+	e := c.queue[0]
+	c.queue = c.queue[1:]
+
+	return e, true
+}
+
+// shutdown closes the connection once the queued events were delivered.
+func (c *Conn[E]) shutdown() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.draining = true
+	c.cond.Broadcast()
+}
+
+func (c *Conn[E]) close() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.closed = true
+	c.queue = nil
+	c.cond.Broadcast()
+
+	return true
+}
+
+// Close closes both ends of the connection.
+func (c *Conn[E]) Close() error {
+	if !c.close() {
+		return errors.New("connection already closed")
+	}
+
+	c.peer.close()
+
+	return nil
+}
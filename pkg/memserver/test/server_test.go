@@ -0,0 +1,108 @@
+package memserver_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/pkg/memserver"
+	"ledctl3/pkg/uuid"
+)
+
+func TestServer(t *testing.T) {
+	network := memserver.NewNetwork[event.Event]()
+
+	reg := network.New("registry")
+
+	type message struct {
+		addr string
+		e    event.Event
+	}
+
+	msgs := make(chan message, 1)
+	reg.SetMessageHandler(func(addr string, e event.Event) {
+		msgs <- message{addr: addr, e: e}
+	})
+
+	disconnected := make(chan string, 2)
+	reg.SetDisconnectHandler(func(addr string) {
+		disconnected <- addr
+	})
+
+	t.Run("refused before start", func(t *testing.T) {
+		dev := network.New("device")
+
+		_, err := dev.Connect("registry")
+		assert.ErrorContains(t, err, "connection refused")
+	})
+
+	assert.NilError(t, reg.Start())
+	defer reg.Stop()
+
+	assert.ErrorContains(t, network.New("registry").Start(), "already in use")
+
+	dev := network.New("device")
+
+	connected := make(chan string, 1)
+	dev.SetConnectHandler(func(addr string) {
+		connected <- addr
+	})
+
+	replies := make(chan event.Event, 1)
+	dev.SetMessageHandler(func(addr string, e event.Event) {
+		replies <- e
+	})
+
+	devDisconnected := make(chan string, 1)
+	dev.SetDisconnectHandler(func(addr string) {
+		devDisconnected <- addr
+	})
+
+	c, err := dev.Connect("registry")
+	assert.NilError(t, err)
+	go dev.ProcessEvents("registry", c)
+
+	select {
+	case addr := <-connected:
+		assert.Equal(t, addr, "registry")
+	case <-time.After(1 * time.Second):
+		t.Fatal("connect handler not called")
+	}
+
+	e := event.Connect{Id: uuid.New()}
+	assert.NilError(t, dev.Write("registry", e))
+
+	var got message
+	select {
+	case got = <-msgs:
+		assert.Equal(t, got.addr, "device")
+		assert.DeepEqual(t, got.e, event.Event(e))
+	case <-time.After(1 * time.Second):
+		t.Fatal("event not received")
+	}
+
+	reply := event.Ack{RequestId: uuid.New()}
+	assert.NilError(t, reg.Write(got.addr, reply))
+
+	select {
+	case e := <-replies:
+		assert.DeepEqual(t, e, event.Event(reply))
+	case <-time.After(1 * time.Second):
+		t.Fatal("reply not received")
+	}
+
+	assert.NilError(t, c.Close())
+
+	for _, ch := range []chan string{disconnected, devDisconnected} {
+		select {
+		case <-ch:
+		case <-time.After(1 * time.Second):
+			t.Fatal("disconnect handler not called")
+		}
+	}
+
+	assert.ErrorIs(t, reg.Write("device", reply), io.ErrClosedPipe)
+}
@@ -0,0 +1,219 @@
+package netserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"ledctl3/pkg/codec"
+)
+
+// DefaultQueueSize is the default number of droppable events that can be
+// queued for a single connection.
+const DefaultQueueSize = 16
+
+// WritePolicy decides how outbound events are queued when a peer cannot
+// keep up.
+type WritePolicy[E any] struct {
+	// Droppable reports whether the event may be discarded when the queue
+	// is full. Events that are not droppable are always queued.
+	Droppable func(e E) bool
+	// Replaces reports whether e supersedes the queued event, in which case
+	// the queued event is discarded and e takes its place in the queue.
+	Replaces func(queued, e E) bool
+}
+
+type QueueStats struct {
+	// Depth is the number of events waiting to be written.
+	Depth int
+	// Dropped is the number of droppable events discarded because the
+	// queue was full.
+	Dropped uint64
+	// Replaced is the number of queued events superseded by newer ones.
+	Replaced uint64
+}
+
+// conn owns the outbound queue of a connection. A single writer goroutine
+// drains the queue, so that a slow peer only ever blocks itself.
+type conn[E any] struct {
+	mux    sync.Mutex
+	cond   *sync.Cond
+	conn   net.Conn
+	codec  codec.Codec[E]
+	policy WritePolicy[E]
+	size   int
+	queue  []queued[E]
+	closed bool
+	// draining is set once the connection is to be closed after the
+	// queued events have been written.
+	draining bool
+	stats    QueueStats
+}
+
+type queued[E any] struct {
+	// heartbeat is set for empty frames, which carry no event.
+	heartbeat bool
+	e         E
+	buf       []byte
+}
+
+func newConn[E any](nc net.Conn, codec codec.Codec[E], policy WritePolicy[E], size int) *conn[E] {
+	c := &conn[E]{
+		conn:   nc,
+		codec:  codec,
+		policy: policy,
+		size:   size,
+	}
+	c.cond = sync.NewCond(&c.mux)
+
+	go c.processQueue()
+
+	return c
+}
+
+// getCodec returns the codec negotiated for the connection.
+func (c *conn[E]) getCodec() codec.Codec[E] {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.codec
+}
+
+func (c *conn[E]) setCodec(codec codec.Codec[E]) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.codec = codec
+}
+
+// enqueue queues a framed event for writing.
+func (c *conn[E]) enqueue(q queued[E]) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closed || c.draining {
+		return io.ErrClosedPipe
+	}
+
+	if !q.heartbeat && c.policy.Replaces != nil {
+		for i, old := range c.queue {
+			if old.heartbeat || !c.policy.Replaces(old.e, q.e) {
+				continue
+			}
+
+			c.queue[i] = q
+			c.stats.Replaced++
+
+			return nil
+		}
+	}
+
+	droppable := !q.heartbeat && c.policy.Droppable != nil && c.policy.Droppable(q.e)
+
+	if droppable && c.droppableQueued() >= c.size {
+		// newer frames are worth more than older ones, so make room by
+		// discarding the oldest droppable event. Events the policy does not
+		// consider droppable, such as keyframes, are never discarded
+		for i, old := range c.queue {
+			if old.heartbeat || !c.policy.Droppable(old.e) {
+				continue
+			}
+
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			c.stats.Dropped++
+
+			break
+		}
+	}
+
+	c.queue = append(c.queue, q)
+	c.cond.Signal()
+
+	return nil
+}
+
+func (c *conn[E]) droppableQueued() int {
+	if c.policy.Droppable == nil {
+		return 0
+	}
+
+	var n int
+	for _, q := range c.queue {
+		if !q.heartbeat && c.policy.Droppable(q.e) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (c *conn[E]) processQueue() {
+	for {
+		c.mux.Lock()
+		for len(c.queue) == 0 && !c.closed && !c.draining {
+			c.cond.Wait()
+		}
+
+		if c.closed {
+			c.mux.Unlock()
+			return
+		}
+
+		if len(c.queue) == 0 {
+			// draining and every queued event was written; the reader
+			// notices the closed connection and tears it down
+			c.mux.Unlock()
+			_ = c.conn.Close()
+			c.close()
+			return
+		}
+
+		q := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mux.Unlock()
+
+		n, err := c.conn.Write(q.buf)
+		if err == nil && n != len(q.buf) {
+			err = io.ErrShortWrite
+		}
+
+		if err != nil {
+			fmt.Println("error during write: ", err)
+
+			// the reader notices the closed connection and tears it down
+			_ = c.conn.Close()
+			c.close()
+			return
+		}
+	}
+}
+
+// shutdown closes the connection once the queued events have been written.
+func (c *conn[E]) shutdown() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.draining = true
+	c.cond.Broadcast()
+}
+
+// close discards any queued events and stops the writer.
+func (c *conn[E]) close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.closed = true
+	c.queue = nil
+	c.cond.Broadcast()
+}
+
+func (c *conn[E]) queueStats() QueueStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	stats := c.stats
+	stats.Depth = len(c.queue)
+
+	return stats
+}
@@ -0,0 +1,76 @@
+package netserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultMaxMessageSize is the default limit for the size of a single
+// frame, large enough for data frames of big matrix outputs.
+const DefaultMaxMessageSize = 4 << 20
+
+var ErrMessageTooLarge = errors.New("message too large")
+
+// Frames consist of a 4-byte little-endian length, followed by that many
+// bytes of an encoded event. A frame with zero length is a heartbeat.
+
+// readFrame reads a single frame from r, blocking until it has been read
+// in full. It returns an empty slice for heartbeats.
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var header [4]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(header[:])
+	if maxSize > 0 && uint64(n) > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d bytes", ErrMessageTooLarge, n, maxSize)
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if errors.Is(err, io.EOF) {
+		// the peer went away in the middle of a frame
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// A dialing peer announces the codec it speaks by sending a preamble frame
+// before any event: a zero byte followed by the name of the codec. No event
+// of a supported codec starts with a zero byte, so peers that do not send a
+// preamble are served with the default codec.
+const maxCodecNameSize = 64
+
+func preamble(name string) []byte {
+	return append([]byte{0}, name...)
+}
+
+// parsePreamble returns the codec name announced by a preamble frame.
+func parsePreamble(b []byte) (string, bool) {
+	if len(b) < 2 || len(b) > 1+maxCodecNameSize || b[0] != 0 {
+		return "", false
+	}
+
+	return string(b[1:]), true
+}
+
+// frame prefixes b with its length.
+func frame(b []byte) ([]byte, error) {
+	if uint64(len(b)) > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(b))
+	}
+
+	buf := make([]byte, 4+len(b))
+	binary.LittleEndian.PutUint32(buf, uint32(len(b)))
+	copy(buf[4:], b)
+
+	return buf, nil
+}
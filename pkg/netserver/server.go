@@ -1,11 +1,14 @@
 package netserver
 
 import (
-	"encoding/binary"
+	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -15,12 +18,19 @@ import (
 type Server[E any] struct {
 	mux               sync.Mutex
 	codec             codec.Codec[E]
+	codecs            map[string]codec.Codec[E]
 	ln                net.Listener
 	port              int
 	handler           func(string, E)
-	conns             map[connId]net.Conn
+	conns             map[connId]*conn[E]
 	connectHandler    func(string)
 	disconnectHandler func(string)
+	heartbeatInterval time.Duration
+	readTimeout       time.Duration
+	maxMessageSize    int
+	writePolicy       WritePolicy[E]
+	queueSize         int
+	tlsConfig         *tls.Config
 }
 
 type connId struct {
@@ -28,35 +38,175 @@ type connId struct {
 	addr string
 }
 
-func New[E any](port int, codec codec.Codec[E]) *Server[E] {
+// New creates a server that speaks the given codecs. The first codec is the
+// default: it is announced on connections the server dials, and used for
+// accepted connections whose peer does not announce a codec.
+func New[E any](port int, codecs ...codec.Codec[E]) *Server[E] {
+	if len(codecs) == 0 {
+		panic("netserver: no codecs")
+	}
+
 	s := &Server[E]{
-		port:  port,
-		codec: codec,
-		conns: map[connId]net.Conn{},
+		port:           port,
+		codec:          codecs[0],
+		codecs:         map[string]codec.Codec[E]{},
+		conns:          map[connId]*conn[E]{},
+		maxMessageSize: DefaultMaxMessageSize,
+		queueSize:      DefaultQueueSize,
+	}
+
+	for _, c := range codecs {
+		s.codecs[c.Name()] = c
 	}
 
 	return s
 }
 
+// SetHeartbeatInterval enables sending an empty frame to every peer when the
+// given interval elapses, so that peers can detect dead connections even if
+// no events are exchanged. Zero disables heartbeats.
+func (s *Server[E]) SetHeartbeatInterval(d time.Duration) {
+	s.heartbeatInterval = d
+}
+
+// SetMaxMessageSize sets the largest frame accepted from a peer. Peers that
+// announce a larger frame are disconnected. Zero disables the limit.
+func (s *Server[E]) SetMaxMessageSize(n int) {
+	s.maxMessageSize = n
+}
+
+// SetTLSConfig enables TLS for both accepted and dialed connections. The
+// config must carry a certificate for servers that accept connections.
+func (s *Server[E]) SetTLSConfig(cfg *tls.Config) {
+	s.tlsConfig = cfg
+}
+
+// SetWritePolicy sets the policy used to queue outbound events. By default,
+// events are never dropped or replaced.
+func (s *Server[E]) SetWritePolicy(p WritePolicy[E]) {
+	s.writePolicy = p
+}
+
+// SetQueueSize sets the number of droppable events that can be queued for a
+// single connection before the oldest of them are dropped.
+func (s *Server[E]) SetQueueSize(n int) {
+	s.queueSize = n
+}
+
+// QueueStats returns the outbound queue statistics of every connection,
+// keyed by address.
+func (s *Server[E]) QueueStats() map[string]QueueStats {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	stats := make(map[string]QueueStats)
+	for id, c := range s.conns {
+		stats[id.addr] = c.queueStats()
+	}
+
+	return stats
+}
+
+// ReportQueueStats prints the queue statistics of every connection that
+// dropped or replaced events since the previous report, once per interval,
+// until ctx is done.
+func (s *Server[E]) ReportQueueStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := map[string]QueueStats{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := s.QueueStats()
+
+		for addr, st := range stats {
+			prev := last[addr]
+			if st.Dropped == prev.Dropped && st.Replaced == prev.Replaced {
+				continue
+			}
+
+			fmt.Printf("%s: queue depth %d, dropped %d, replaced %d\n",
+				addr, st.Depth, st.Dropped-prev.Dropped, st.Replaced-prev.Replaced)
+		}
+
+		last = stats
+	}
+}
+
+// SetReadTimeout closes connections that have not received any frame,
+// including heartbeats, within the given duration. The disconnect handler is
+// called for timed out connections. Zero disables the timeout.
+func (s *Server[E]) SetReadTimeout(d time.Duration) {
+	s.readTimeout = d
+}
+
 func (s *Server[E]) Connect(addr net.Addr) (net.Conn, error) {
-	c, err := net.DialTimeout(addr.Network(), addr.String(), 1*time.Second)
+	var c net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		dialer := &net.Dialer{Timeout: 1 * time.Second}
+		c, err = tls.DialWithDialer(dialer, addr.Network(), addr.String(), s.tlsConfig)
+	} else {
+		c, err = net.DialTimeout(addr.Network(), addr.String(), 1*time.Second)
+	}
 	if err != nil {
 		fmt.Println("error during dial: ", err)
 		return nil, err
 	}
 
+	// announce the codec before the writer starts, so that it precedes
+	// every event
+	buf, err := frame(preamble(s.codec.Name()))
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	_, err = c.Write(buf)
+	if err != nil {
+		fmt.Println("error during write: ", err)
+		_ = c.Close()
+		return nil, err
+	}
+
 	id := connId{
 		netw: addr.Network(),
 		addr: addr.String(),
 	}
 
 	s.mux.Lock()
-	s.conns[id] = c
+	s.conns[id] = newConn(c, s.codec, s.writePolicy, s.queueSize)
 	s.mux.Unlock()
 
 	return c, nil
 }
 
+// Dial connects to the server at addr and processes its events until the
+// connection is closed.
+func (s *Server[E]) Dial(addr string) error {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.Connect(tcpAddr)
+	if err != nil {
+		return err
+	}
+
+	s.ProcessEvents(tcpAddr, c)
+
+	_ = c.Close()
+
+	return nil
+}
+
 func (s *Server[E]) Start() error {
 	if s.port == -1 {
 		return errors.New("server disabled")
@@ -67,12 +217,18 @@ func (s *Server[E]) Start() error {
 		return err
 	}
 
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+
 	s.ln = ln
 
 	go func() {
 		for {
 			c, err := ln.Accept()
-			if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
 				fmt.Println(err)
 				continue
 			}
@@ -83,7 +239,7 @@ func (s *Server[E]) Start() error {
 			}
 
 			s.mux.Lock()
-			s.conns[id] = c
+			s.conns[id] = newConn(c, s.codec, s.writePolicy, s.queueSize)
 			s.mux.Unlock()
 
 			go s.ProcessEvents(c.RemoteAddr(), c)
@@ -97,7 +253,7 @@ func (s *Server[E]) Stop() {
 	_ = s.ln.Close()
 }
 
-func (s *Server[E]) ProcessEvents(addr net.Addr, conn net.Conn) {
+func (s *Server[E]) ProcessEvents(addr net.Addr, nc net.Conn) {
 	//fmt.Println("PROCESSING EVENTS FROM", addr)
 	//defer fmt.Println("HANDLE CONN DONE")
 
@@ -111,69 +267,114 @@ func (s *Server[E]) ProcessEvents(addr net.Addr, conn net.Conn) {
 		s.connectHandler(addr.String())
 	}
 
+	id := connId{
+		netw: addr.Network(),
+		addr: addr.String(),
+	}
+
+	s.mux.Lock()
+	c, ok := s.conns[id]
+	if !ok {
+		c = newConn(nc, s.codec, s.writePolicy, s.queueSize)
+		s.conns[id] = c
+	}
+	s.mux.Unlock()
+
 	defer func() {
-		id := connId{
-			netw: addr.Network(),
-			addr: addr.String(),
-		}
+		c.close()
 
 		s.mux.Lock()
-		s.conns[id] = nil
+		delete(s.conns, id)
 		s.mux.Unlock()
 	}()
 
-	var foundLength bool
-	var msglen uint32
-	sizeBuf := make([]byte, 4)
+	if s.heartbeatInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
 
+		go s.sendHeartbeats(c, done)
+	}
+
+	r := bufio.NewReader(nc)
+
+	first := true
 	for {
-		if !foundLength {
-			n, err := conn.Read(sizeBuf)
-			if err != nil {
-				_ = conn.Close()
-				fmt.Println("error during read: ", err)
-				return
-			}
+		if s.readTimeout > 0 {
+			_ = nc.SetReadDeadline(time.Now().Add(s.readTimeout))
+		}
 
-			if n != 4 {
-				fmt.Println("invalid header")
-				continue
-			}
+		b, err := readFrame(r, s.maxMessageSize)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			_ = nc.Close()
+			fmt.Println("connection timed out: ", addr)
+			return
+		} else if errors.Is(err, ErrMessageTooLarge) {
+			// the rest of the stream cannot be trusted, so drop the peer
+			// instead of trying to resync
+			_ = nc.Close()
+			fmt.Println("closing connection to", addr, "after malformed frame: ", err)
+			return
+		} else if err != nil {
+			_ = nc.Close()
+			fmt.Println("error during read: ", err)
+			return
+		}
 
-			msglen = binary.LittleEndian.Uint32(sizeBuf)
-			if msglen > 0 {
-				foundLength = true
-			} else {
-				fmt.Println("ACK")
-			}
-		} else {
-			readBuf := make([]byte, msglen)
-			n, err := conn.Read(readBuf)
-			if err != nil {
-				_ = conn.Close()
-				fmt.Println("error during read: ", err)
-				return
-			}
+		// a zero length frame is a heartbeat, which only serves to extend
+		// the read deadline
+		if len(b) == 0 {
+			continue
+		}
 
-			if n != int(msglen) {
-				fmt.Println("invalid message")
-				continue
-			}
+		if first {
+			first = false
 
-			var e E
-			err = s.codec.UnmarshalEvent(readBuf, &e)
-			if err != nil {
-				fmt.Println("error during unmarshal: ", err)
+			if name, ok := parsePreamble(b); ok {
+				cdc, ok := s.codecs[name]
+				if !ok {
+					_ = nc.Close()
+					fmt.Println("closing connection to", addr, "with unsupported codec: ", name)
+					return
+				}
+
+				c.setCodec(cdc)
 				continue
 			}
+		}
+
+		var e E
+		err = c.getCodec().UnmarshalEvent(b, &e)
+		if err != nil {
+			fmt.Println("error during unmarshal: ", err)
+			continue
+		}
 
-			//fmt.Println("received msg")
+		//fmt.Println("received msg")
 
-			if s.handler != nil {
-				s.handler(addr.String(), e)
-			}
+		if s.handler != nil {
+			s.handler(addr.String(), e)
+		}
+	}
+}
+
+func (s *Server[E]) sendHeartbeats(c *conn[E], done <-chan struct{}) {
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
 
-			foundLength = false
+	heartbeat := make([]byte, 4)
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := c.enqueue(queued[E]{
+				heartbeat: true,
+				buf:       heartbeat,
+			})
+			if err != nil {
+				return
+			}
 		}
 	}
 }
@@ -193,33 +394,42 @@ func (s *Server[E]) Write(addr string, e E) error {
 		return io.ErrClosedPipe
 	}
 
-	if conn == nil {
-		fmt.Println("conn nil for addr", addr)
-		return io.ErrClosedPipe
-	}
-
-	buf, err := s.codec.MarshalEvent(e)
+	buf, err := conn.getCodec().MarshalEvent(e)
 	if err != nil {
 		fmt.Println("error during marshal: ", err)
 		return err
 	}
 
-	length := make([]byte, 4)
-	binary.LittleEndian.PutUint32(length, uint32(len(buf)))
-	buf = append(length, buf...)
-
-	n, err := conn.Write(buf)
+	buf, err = frame(buf)
 	if err != nil {
 		fmt.Println("error during write: ", err)
-		_ = conn.Close()
 		return err
 	}
 
-	if n != len(buf) {
-		fmt.Println("short write")
-		return io.ErrShortWrite
+	// the event is written asynchronously by the connection's writer, so
+	// that a slow peer does not block the caller
+	return conn.enqueue(queued[E]{
+		e:   e,
+		buf: buf,
+	})
+}
+
+func (s *Server[E]) Close(addr string) error {
+	id := connId{
+		netw: "tcp",
+		addr: addr,
 	}
 
+	s.mux.Lock()
+	conn, ok := s.conns[id]
+	s.mux.Unlock()
+
+	if !ok {
+		return io.ErrClosedPipe
+	}
+
+	conn.shutdown()
+
 	return nil
 }
 
@@ -0,0 +1,298 @@
+package netserver_test
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/pkg/codec"
+	"ledctl3/pkg/netserver"
+	"ledctl3/pkg/uuid"
+)
+
+// freePort reserves a free port for a server.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.NilError(t, ln.Close())
+
+	return port
+}
+
+func listen(t *testing.T) (*netserver.Server[event.Event], net.Addr) {
+	t.Helper()
+
+	port := freePort(t)
+
+	s := netserver.New[event.Event](port, event.Codec)
+
+	return s, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Run("silent peer times out", func(t *testing.T) {
+		s, addr := listen(t)
+		s.SetReadTimeout(100 * time.Millisecond)
+
+		disconnected := make(chan string, 1)
+		s.SetDisconnectHandler(func(addr string) {
+			disconnected <- addr
+		})
+
+		assert.NilError(t, s.Start())
+		defer s.Stop()
+
+		c, err := net.Dial("tcp", addr.String())
+		assert.NilError(t, err)
+		defer c.Close()
+
+		select {
+		case got := <-disconnected:
+			assert.Equal(t, got, c.LocalAddr().String())
+		case <-time.After(1 * time.Second):
+			t.Fatal("connection did not time out")
+		}
+	})
+
+	t.Run("heartbeats keep connection alive", func(t *testing.T) {
+		s, addr := listen(t)
+		s.SetReadTimeout(100 * time.Millisecond)
+
+		disconnected := make(chan string, 1)
+		s.SetDisconnectHandler(func(addr string) {
+			disconnected <- addr
+		})
+
+		assert.NilError(t, s.Start())
+		defer s.Stop()
+
+		client := netserver.New[event.Event](-1, event.Codec)
+		client.SetHeartbeatInterval(20 * time.Millisecond)
+
+		c, err := client.Connect(addr)
+		assert.NilError(t, err)
+		go client.ProcessEvents(addr, c)
+		defer c.Close()
+
+		select {
+		case <-disconnected:
+			t.Fatal("connection timed out")
+		case <-time.After(300 * time.Millisecond):
+		}
+	})
+}
+
+func TestFraming(t *testing.T) {
+	s, addr := listen(t)
+	s.SetMaxMessageSize(1024)
+
+	events := make(chan event.Event, 1)
+	s.SetMessageHandler(func(addr string, e event.Event) {
+		events <- e
+	})
+
+	disconnected := make(chan string, 1)
+	s.SetDisconnectHandler(func(addr string) {
+		disconnected <- addr
+	})
+
+	assert.NilError(t, s.Start())
+	defer s.Stop()
+
+	t.Run("frame split across partial reads", func(t *testing.T) {
+		c, err := net.Dial("tcp", addr.String())
+		assert.NilError(t, err)
+		defer c.Close()
+
+		e := event.Connect{Id: uuid.New()}
+		b, err := event.Codec.MarshalEvent(e)
+		assert.NilError(t, err)
+
+		buf := binary.LittleEndian.AppendUint32(nil, uint32(len(b)))
+		buf = append(buf, b...)
+
+		// heartbeat followed by the event, one byte at a time
+		buf = append([]byte{0, 0, 0, 0}, buf...)
+		for _, b := range buf {
+			_, err = c.Write([]byte{b})
+			assert.NilError(t, err)
+			time.Sleep(time.Millisecond)
+		}
+
+		select {
+		case got := <-events:
+			assert.DeepEqual(t, got, event.Event(e))
+		case <-time.After(1 * time.Second):
+			t.Fatal("event not received")
+		}
+	})
+
+	t.Run("oversized frame closes connection", func(t *testing.T) {
+		c, err := net.Dial("tcp", addr.String())
+		assert.NilError(t, err)
+		defer c.Close()
+
+		_, err = c.Write(binary.LittleEndian.AppendUint32(nil, 1<<30))
+		assert.NilError(t, err)
+
+		for {
+			select {
+			case got := <-disconnected:
+				if got != c.LocalAddr().String() {
+					// disconnect of the previous subtest's connection
+					continue
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("connection not closed")
+			}
+
+			break
+		}
+	})
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	port := freePort(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+
+	s := netserver.New[event.Event](port, event.Codec, event.MsgpackCodec)
+
+	type message struct {
+		addr string
+		e    event.Event
+	}
+
+	msgs := make(chan message, 1)
+	s.SetMessageHandler(func(addr string, e event.Event) {
+		msgs <- message{addr: addr, e: e}
+	})
+
+	assert.NilError(t, s.Start())
+	defer s.Stop()
+
+	for _, cdc := range []codec.Codec[event.Event]{event.Codec, event.MsgpackCodec} {
+		cdc := cdc
+
+		t.Run(cdc.Name(), func(t *testing.T) {
+			client := netserver.New[event.Event](-1, cdc)
+
+			replies := make(chan event.Event, 1)
+			client.SetMessageHandler(func(addr string, e event.Event) {
+				replies <- e
+			})
+
+			c, err := client.Connect(addr)
+			assert.NilError(t, err)
+			go client.ProcessEvents(addr, c)
+			defer c.Close()
+
+			e := event.Connect{Id: uuid.New(), Codecs: []string{cdc.Name()}}
+			assert.NilError(t, client.Write(addr.String(), e))
+
+			var got message
+			select {
+			case got = <-msgs:
+				assert.DeepEqual(t, got.e, event.Event(e))
+			case <-time.After(1 * time.Second):
+				t.Fatal("event not received")
+			}
+
+			// the reply is encoded with the codec of the connection
+			reply := event.Ack{RequestId: uuid.New()}
+			assert.NilError(t, s.Write(got.addr, reply))
+
+			select {
+			case e := <-replies:
+				assert.DeepEqual(t, e, event.Event(reply))
+			case <-time.After(1 * time.Second):
+				t.Fatal("reply not received")
+			}
+		})
+	}
+
+	t.Run("unsupported codec closes connection", func(t *testing.T) {
+		client := netserver.New[event.Event](-1, event.JSONCodec)
+
+		disconnected := make(chan string, 1)
+		client.SetDisconnectHandler(func(addr string) {
+			disconnected <- addr
+		})
+
+		c, err := client.Connect(addr)
+		assert.NilError(t, err)
+		go client.ProcessEvents(addr, c)
+		defer c.Close()
+
+		select {
+		case <-disconnected:
+		case <-time.After(1 * time.Second):
+			t.Fatal("connection not closed")
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	s, addr := listen(t)
+
+	connected := make(chan string, 1)
+	s.SetConnectHandler(func(addr string) {
+		connected <- addr
+	})
+
+	assert.NilError(t, s.Start())
+	defer s.Stop()
+
+	client := netserver.New[event.Event](-1, event.Codec)
+
+	replies := make(chan event.Event, 1)
+	client.SetMessageHandler(func(addr string, e event.Event) {
+		replies <- e
+	})
+
+	disconnected := make(chan string, 1)
+	client.SetDisconnectHandler(func(addr string) {
+		disconnected <- addr
+	})
+
+	c, err := client.Connect(addr)
+	assert.NilError(t, err)
+	go client.ProcessEvents(addr, c)
+	defer c.Close()
+
+	var peer string
+	select {
+	case peer = <-connected:
+	case <-time.After(1 * time.Second):
+		t.Fatal("connection not accepted")
+	}
+
+	e := event.Error{Code: event.ErrorCodeUnauthorized}
+	assert.NilError(t, s.Write(peer, e))
+	assert.NilError(t, s.Close(peer))
+
+	t.Run("queued events sent before closing", func(t *testing.T) {
+		select {
+		case got := <-replies:
+			assert.DeepEqual(t, got, event.Event(e))
+		case <-time.After(1 * time.Second):
+			t.Fatal("event not received")
+		}
+	})
+
+	t.Run("connection closed", func(t *testing.T) {
+		select {
+		case <-disconnected:
+		case <-time.After(1 * time.Second):
+			t.Fatal("connection not closed")
+		}
+
+		assert.ErrorContains(t, s.Write(peer, e), "closed pipe")
+	})
+}
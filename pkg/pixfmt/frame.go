@@ -0,0 +1,182 @@
+package pixfmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"math/rand"
+)
+
+// Frame is a packed frame of pixels for a single output. A keyframe carries
+// every pixel in Pix, while a delta frame only carries the ranges of pixels
+// that differ from the keyframe it refers to.
+type Frame struct {
+	Format Format
+	Key    uint32
+	Pix    []byte
+	Delta  []Range
+}
+
+// Range is a run of packed pixels starting at pixel Offset.
+type Range struct {
+	Offset int
+	Pix    []byte
+}
+
+func (f Frame) Keyframe() bool {
+	return f.Pix != nil
+}
+
+const (
+	// DefaultKeyframeInterval is the number of frames after which a new
+	// keyframe is sent, even if deltas would be smaller.
+	DefaultKeyframeInterval = 60
+
+	// maxRangeGap is the number of unchanged pixels that are included in a
+	// range instead of starting a new one, as every range has some overhead.
+	maxRangeGap = 4
+)
+
+// Encoder encodes consecutive frames of an output, sending deltas against
+// the last keyframe whenever they are smaller than a full frame.
+type Encoder struct {
+	format   Format
+	interval int
+	key      uint32
+	keyPix   []byte
+	frames   int
+}
+
+func NewEncoder(format Format, keyframeInterval int) *Encoder {
+	return &Encoder{
+		format:   format,
+		interval: keyframeInterval,
+		// start from a random key so that a decoder that outlived a previous
+		// encoder does not apply deltas on top of a stale keyframe
+		key: rand.Uint32(),
+	}
+}
+
+func (e *Encoder) Encode(pix []color.Color) (Frame, error) {
+	b, err := Pack(e.format, pix)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	e.frames++
+
+	if e.keyPix == nil || len(b) != len(e.keyPix) || e.frames >= e.interval {
+		return e.keyframe(b), nil
+	}
+
+	delta := diff(e.format.Stride(), e.keyPix, b)
+
+	var size int
+	for _, r := range delta {
+		size += len(r.Pix)
+	}
+
+	// a delta that touches most of the strip is not worth it; refresh the
+	// keyframe instead so that subsequent deltas become smaller
+	if size > len(b)/2 {
+		return e.keyframe(b), nil
+	}
+
+	return Frame{
+		Format: e.format,
+		Key:    e.key,
+		Delta:  delta,
+	}, nil
+}
+
+func (e *Encoder) keyframe(b []byte) Frame {
+	e.key++
+	e.keyPix = b
+	e.frames = 0
+
+	return Frame{
+		Format: e.format,
+		Key:    e.key,
+		Pix:    b,
+	}
+}
+
+func diff(stride int, prev, next []byte) []Range {
+	var ranges []Range
+
+	start, end := -1, -1
+	for i := 0; i < len(next)/stride; i++ {
+		if bytes.Equal(prev[i*stride:i*stride+stride], next[i*stride:i*stride+stride]) {
+			continue
+		}
+
+		if start != -1 && i-end > maxRangeGap {
+			ranges = append(ranges, Range{
+				Offset: start,
+				Pix:    next[start*stride : end*stride],
+			})
+			start = -1
+		}
+
+		if start == -1 {
+			start = i
+		}
+
+		end = i + 1
+	}
+
+	if start != -1 {
+		ranges = append(ranges, Range{
+			Offset: start,
+			Pix:    next[start*stride : end*stride],
+		})
+	}
+
+	return ranges
+}
+
+var ErrMissingKeyframe = errors.New("missing keyframe")
+
+// Decoder reconstructs the pixels of an output from consecutive frames.
+type Decoder struct {
+	key    uint32
+	keyPix []byte
+	format Format
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+func (d *Decoder) Decode(f Frame) ([]color.Color, error) {
+	if f.Keyframe() {
+		d.key = f.Key
+		d.keyPix = f.Pix
+		d.format = f.Format
+
+		return Unpack(f.Format, f.Pix)
+	}
+
+	// deltas are only meaningful on top of the keyframe they were diffed
+	// against; drop them until that keyframe arrives
+	if d.keyPix == nil || f.Key != d.key || f.Format != d.format {
+		return nil, ErrMissingKeyframe
+	}
+
+	stride := f.Format.Stride()
+
+	b := make([]byte, len(d.keyPix))
+	copy(b, d.keyPix)
+
+	for _, r := range f.Delta {
+		off := r.Offset * stride
+		if off < 0 || off+len(r.Pix) > len(b) {
+			return nil, fmt.Errorf("delta range out of bounds: offset %d, length %d", r.Offset, len(r.Pix))
+		}
+
+		copy(b[off:], r.Pix)
+	}
+
+	return Unpack(f.Format, b)
+}
@@ -0,0 +1,87 @@
+package pixfmt
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+)
+
+type Format string
+
+const (
+	RGB  Format = "rgb"
+	RGBW Format = "rgbw"
+)
+
+// Stride returns the number of bytes a single pixel occupies.
+func (f Format) Stride() int {
+	switch f {
+	case RGB:
+		return 3
+	case RGBW:
+		return 4
+	default:
+		return 0
+	}
+}
+
+var ErrInvalidFormat = errors.New("invalid pixel format")
+
+// Pack packs the given colors into a byte slice in the given format. For
+// RGBW, the white channel carries the part of the color that is shared by
+// all of the red, green and blue channels.
+func Pack(f Format, pix []color.Color) ([]byte, error) {
+	stride := f.Stride()
+	if stride == 0 {
+		return nil, ErrInvalidFormat
+	}
+
+	b := make([]byte, len(pix)*stride)
+	for i, c := range pix {
+		nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+		r, g, bl := nrgba.R, nrgba.G, nrgba.B
+
+		switch f {
+		case RGB:
+			b[i*3], b[i*3+1], b[i*3+2] = r, g, bl
+		case RGBW:
+			w := r
+			if g < w {
+				w = g
+			}
+			if bl < w {
+				w = bl
+			}
+
+			b[i*4], b[i*4+1], b[i*4+2], b[i*4+3] = r-w, g-w, bl-w, w
+		}
+	}
+
+	return b, nil
+}
+
+// Unpack unpacks a byte slice of pixels in the given format into colors.
+func Unpack(f Format, b []byte) ([]color.Color, error) {
+	stride := f.Stride()
+	if stride == 0 {
+		return nil, ErrInvalidFormat
+	}
+
+	if len(b)%stride != 0 {
+		return nil, fmt.Errorf("invalid %s pixel data length %d", f, len(b))
+	}
+
+	pix := make([]color.Color, len(b)/stride)
+	for i := range pix {
+		p := b[i*stride : i*stride+stride]
+
+		switch f {
+		case RGB:
+			pix[i] = color.NRGBA{R: p[0], G: p[1], B: p[2], A: 255}
+		case RGBW:
+			pix[i] = color.NRGBA{R: p[0] + p[3], G: p[1] + p[3], B: p[2] + p[3], A: 255}
+		}
+	}
+
+	return pix, nil
+}
@@ -0,0 +1,117 @@
+package pixfmt_test
+
+import (
+	"image/color"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/pkg/pixfmt"
+)
+
+func strip(leds int, c color.NRGBA) []color.Color {
+	pix := make([]color.Color, leds)
+	for i := range pix {
+		pix[i] = c
+	}
+
+	return pix
+}
+
+func TestPack(t *testing.T) {
+	pix := []color.Color{
+		color.NRGBA{R: 255, G: 128, B: 0, A: 255},
+		color.NRGBA{R: 200, G: 200, B: 250, A: 255},
+	}
+
+	t.Run("rgb", func(t *testing.T) {
+		b, err := pixfmt.Pack(pixfmt.RGB, pix)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, b, []byte{255, 128, 0, 200, 200, 250})
+
+		got, err := pixfmt.Unpack(pixfmt.RGB, b)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, pix)
+	})
+
+	t.Run("rgbw", func(t *testing.T) {
+		b, err := pixfmt.Pack(pixfmt.RGBW, pix)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, b, []byte{255, 128, 0, 0, 0, 0, 50, 200})
+
+		got, err := pixfmt.Unpack(pixfmt.RGBW, b)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, pix)
+	})
+
+	t.Run("invalid length", func(t *testing.T) {
+		_, err := pixfmt.Unpack(pixfmt.RGB, []byte{1, 2})
+		assert.Error(t, err, "invalid rgb pixel data length 2")
+	})
+}
+
+func TestEncoder(t *testing.T) {
+	enc := pixfmt.NewEncoder(pixfmt.RGB, pixfmt.DefaultKeyframeInterval)
+	dec := pixfmt.NewDecoder()
+
+	black := color.NRGBA{A: 255}
+	red := color.NRGBA{R: 255, A: 255}
+
+	pix := strip(300, black)
+
+	var key uint32
+	t.Run("first frame is a keyframe", func(t *testing.T) {
+		f, err := enc.Encode(pix)
+		assert.NilError(t, err)
+		assert.Assert(t, f.Keyframe())
+		assert.Equal(t, len(f.Pix), 900)
+		key = f.Key
+
+		got, err := dec.Decode(f)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, pix)
+	})
+
+	t.Run("changed ranges are sent as delta", func(t *testing.T) {
+		pix[10] = red
+		pix[12] = red
+		pix[200] = red
+
+		f, err := enc.Encode(pix)
+		assert.NilError(t, err)
+		assert.Assert(t, !f.Keyframe())
+		assert.Equal(t, f.Key, key)
+		assert.DeepEqual(t, f.Delta, []pixfmt.Range{
+			{Offset: 10, Pix: []byte{255, 0, 0, 0, 0, 0, 255, 0, 0}},
+			{Offset: 200, Pix: []byte{255, 0, 0}},
+		})
+
+		got, err := dec.Decode(f)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, pix)
+	})
+
+	t.Run("deltas without their keyframe are dropped", func(t *testing.T) {
+		pix[11] = red
+
+		f, err := enc.Encode(pix)
+		assert.NilError(t, err)
+		assert.Assert(t, !f.Keyframe())
+
+		_, err = pixfmt.NewDecoder().Decode(f)
+		assert.ErrorIs(t, err, pixfmt.ErrMissingKeyframe)
+	})
+
+	t.Run("large changes are sent as keyframe", func(t *testing.T) {
+		pix = strip(300, red)
+
+		f, err := enc.Encode(pix)
+		assert.NilError(t, err)
+		assert.Assert(t, f.Keyframe())
+		assert.Equal(t, f.Key, key+1)
+
+		got, err := dec.Decode(f)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, pix)
+	})
+}
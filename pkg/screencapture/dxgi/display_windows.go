@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"image"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/kirides/screencapture/d3d"
@@ -28,6 +29,7 @@ type display struct {
 	devCtx      *d3d.ID3D11DeviceContext
 	ddup        *d3d.OutputDuplicator
 	orientation types.Orientation
+	framerate   atomic.Int64
 }
 
 func (d *display) Id() int {
@@ -61,11 +63,18 @@ func (d *display) String() string {
 func (d *display) Capture(ctx context.Context, framerate int) chan []byte {
 	frames := make(chan []byte)
 
+	d.framerate.Store(int64(framerate))
+
 	go func() {
 		ticker := time.NewTicker(time.Duration(1000/framerate) * time.Millisecond)
 		defer ticker.Stop()
 
 		for range ticker.C {
+			if rate := int(d.framerate.Load()); rate != framerate {
+				framerate = rate
+				ticker.Reset(time.Duration(1000/framerate) * time.Millisecond)
+			}
+
 			select {
 			case <-ctx.Done():
 				fmt.Println(d.id, "context done")
@@ -102,6 +111,10 @@ func (d *display) Capture(ctx context.Context, framerate int) chan []byte {
 	return frames
 }
 
+func (d *display) SetFramerate(framerate int) {
+	d.framerate.Store(int64(framerate))
+}
+
 func (d *display) Orientation() types.Orientation {
 	return d.orientation
 }
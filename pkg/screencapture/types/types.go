@@ -16,6 +16,8 @@ type Display interface {
 	String() string
 	Close() error
 	Capture(ctx context.Context, framerate int) chan []byte
+	// SetFramerate changes the framerate of a running capture.
+	SetFramerate(framerate int)
 	Orientation() Orientation
 }
 
@@ -0,0 +1,21 @@
+package transport
+
+// Transport carries events between the registry and devices. Peers are
+// identified by the address of their connection, which is passed to every
+// handler and used to write back to them. netserver, wsserver and memserver
+// all implement it.
+type Transport[E any] interface {
+	// Start accepts connections from peers.
+	Start() error
+	// Dial connects to the peer at addr and serves the connection like an
+	// accepted one. It returns once the connection is closed.
+	Dial(addr string) error
+	// Write sends an event to the peer at addr.
+	Write(addr string, e E) error
+	// Close closes the connection to the peer at addr once the events
+	// already written to it have been sent.
+	Close(addr string) error
+	SetMessageHandler(h func(addr string, e E))
+	SetConnectHandler(h func(addr string))
+	SetDisconnectHandler(h func(addr string))
+}
@@ -0,0 +1,267 @@
+package wsserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"ledctl3/pkg/codec"
+)
+
+// Server is a WebSocket counterpart of netserver.Server. Every event is sent
+// as a single binary WebSocket message, so no additional framing is needed.
+// Codecs are negotiated as WebSocket subprotocols named after the codec.
+type Server[E any] struct {
+	mux               sync.Mutex
+	codec             codec.Codec[E]
+	codecs            map[string]codec.Codec[E]
+	upgrader          websocket.Upgrader
+	srv               *http.Server
+	port              int
+	handler           func(string, E)
+	conns             map[string]*conn[E]
+	connectHandler    func(string)
+	disconnectHandler func(string)
+}
+
+type conn[E any] struct {
+	mux   sync.Mutex
+	conn  *websocket.Conn
+	codec codec.Codec[E]
+}
+
+// New creates a server that speaks the given codecs, in order of
+// preference. The first codec is the default: it is requested on
+// connections the server dials, and used for accepted connections that do
+// not request a subprotocol.
+func New[E any](port int, codecs ...codec.Codec[E]) *Server[E] {
+	if len(codecs) == 0 {
+		panic("wsserver: no codecs")
+	}
+
+	s := &Server[E]{
+		port:   port,
+		codec:  codecs[0],
+		codecs: map[string]codec.Codec[E]{},
+		conns:  map[string]*conn[E]{},
+		upgrader: websocket.Upgrader{
+			// allow browser dashboards served from any origin on the network
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+
+	for _, c := range codecs {
+		s.codecs[c.Name()] = c
+		s.upgrader.Subprotocols = append(s.upgrader.Subprotocols, c.Name())
+	}
+
+	return s
+}
+
+// codecFor returns the codec of the subprotocol negotiated for c.
+func (s *Server[E]) codecFor(c *websocket.Conn) codec.Codec[E] {
+	cdc, ok := s.codecs[c.Subprotocol()]
+	if !ok {
+		return s.codec
+	}
+
+	return cdc
+}
+
+func (s *Server[E]) Connect(addr net.Addr) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 1 * time.Second,
+		Subprotocols:     []string{s.codec.Name()},
+	}
+
+	c, _, err := dialer.Dial(fmt.Sprintf("ws://%s/", addr.String()), nil)
+	if err != nil {
+		fmt.Println("error during dial: ", err)
+		return nil, err
+	}
+
+	s.mux.Lock()
+	s.conns[addr.String()] = &conn[E]{conn: c, codec: s.codecFor(c)}
+	s.mux.Unlock()
+
+	return c, nil
+}
+
+// Dial connects to the server at addr and processes its events until the
+// connection is closed.
+func (s *Server[E]) Dial(addr string) error {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.Connect(tcpAddr)
+	if err != nil {
+		return err
+	}
+
+	s.ProcessEvents(tcpAddr, c)
+
+	_ = c.Close()
+
+	return nil
+}
+
+func (s *Server[E]) Start() error {
+	if s.port == -1 {
+		return errors.New("server disabled")
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", s.port))
+	if err != nil {
+		return err
+	}
+
+	s.srv = &http.Server{
+		Handler: http.HandlerFunc(s.serveHTTP),
+	}
+
+	go func() {
+		err := s.srv.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println(err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server[E]) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Println("error during upgrade: ", err)
+		return
+	}
+
+	s.mux.Lock()
+	s.conns[c.RemoteAddr().String()] = &conn[E]{conn: c, codec: s.codecFor(c)}
+	s.mux.Unlock()
+
+	s.ProcessEvents(c.RemoteAddr(), c)
+}
+
+// Stop stops accepting connections and closes the open ones, including the
+// connections the server dialed.
+func (s *Server[E]) Stop() {
+	if s.srv != nil {
+		_ = s.srv.Close()
+	}
+
+	// hijacked connections are not closed by the http server
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, c := range s.conns {
+		_ = c.conn.Close()
+	}
+}
+
+func (s *Server[E]) ProcessEvents(addr net.Addr, c *websocket.Conn) {
+	if s.disconnectHandler != nil {
+		defer func() {
+			s.disconnectHandler(addr.String())
+		}()
+	}
+
+	if s.connectHandler != nil {
+		s.connectHandler(addr.String())
+	}
+
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, addr.String())
+		s.mux.Unlock()
+	}()
+
+	cdc := s.codecFor(c)
+
+	for {
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			_ = c.Close()
+			fmt.Println("error during read: ", err)
+			return
+		}
+
+		var e E
+		err = cdc.UnmarshalEvent(b, &e)
+		if err != nil {
+			fmt.Println("error during unmarshal: ", err)
+			continue
+		}
+
+		if s.handler != nil {
+			s.handler(addr.String(), e)
+		}
+	}
+}
+
+func (s *Server[E]) Write(addr string, e E) error {
+	s.mux.Lock()
+	c, ok := s.conns[addr]
+	s.mux.Unlock()
+
+	if !ok {
+		fmt.Println("no connection for addr", addr)
+		return io.ErrClosedPipe
+	}
+
+	buf, err := c.codec.MarshalEvent(e)
+	if err != nil {
+		fmt.Println("error during marshal: ", err)
+		return err
+	}
+
+	// websocket connections support a single concurrent writer
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	err = c.conn.WriteMessage(websocket.BinaryMessage, buf)
+	if err != nil {
+		fmt.Println("error during write: ", err)
+		_ = c.conn.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server[E]) Close(addr string) error {
+	s.mux.Lock()
+	c, ok := s.conns[addr]
+	s.mux.Unlock()
+
+	if !ok {
+		return io.ErrClosedPipe
+	}
+
+	// events are written synchronously, so once no write is in progress
+	// every event has been sent
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.conn.Close()
+}
+
+func (s *Server[E]) SetMessageHandler(h func(addr string, e E)) {
+	s.handler = h
+}
+
+func (s *Server[E]) SetConnectHandler(h func(addr string)) {
+	s.connectHandler = h
+}
+
+func (s *Server[E]) SetDisconnectHandler(h func(addr string)) {
+	s.disconnectHandler = h
+}
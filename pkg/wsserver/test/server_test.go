@@ -0,0 +1,110 @@
+package wsserver_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"ledctl3/event"
+	"ledctl3/pkg/uuid"
+	"ledctl3/pkg/wsserver"
+)
+
+// freePort reserves a free port for a server.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.NilError(t, ln.Close())
+
+	return port
+}
+
+type message struct {
+	addr string
+	e    event.Event
+}
+
+func recv[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(1 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	var v T
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	port := freePort(t)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	srv := wsserver.New[event.Event](port, event.JSONCodec, event.Codec)
+	client := wsserver.New[event.Event](-1, event.Codec)
+
+	srvConnected := make(chan string, 1)
+	srvDisconnected := make(chan string, 1)
+	srvMsgs := make(chan message, 1)
+
+	srv.SetConnectHandler(func(addr string) { srvConnected <- addr })
+	srv.SetDisconnectHandler(func(addr string) { srvDisconnected <- addr })
+	srv.SetMessageHandler(func(addr string, e event.Event) { srvMsgs <- message{addr: addr, e: e} })
+
+	clientConnected := make(chan string, 1)
+	clientDisconnected := make(chan string, 1)
+	clientMsgs := make(chan message, 1)
+
+	client.SetConnectHandler(func(addr string) { clientConnected <- addr })
+	client.SetDisconnectHandler(func(addr string) { clientDisconnected <- addr })
+	client.SetMessageHandler(func(addr string, e event.Event) { clientMsgs <- message{addr: addr, e: e} })
+
+	assert.NilError(t, srv.Start())
+	defer srv.Stop()
+
+	dialed := make(chan error, 1)
+	go func() {
+		dialed <- client.Dial(addr)
+	}()
+
+	clientAddr := recv(t, srvConnected)
+	assert.Equal(t, recv(t, clientConnected), addr)
+
+	t.Run("server to client", func(t *testing.T) {
+		e := event.Ack{RequestId: uuid.New()}
+		assert.NilError(t, srv.Write(clientAddr, e))
+
+		msg := recv(t, clientMsgs)
+		assert.Equal(t, msg.addr, addr)
+		assert.DeepEqual(t, msg.e, event.Event(e))
+	})
+
+	t.Run("client to server", func(t *testing.T) {
+		e := event.Connect{Id: uuid.New(), Version: event.ProtocolVersion}
+		assert.NilError(t, client.Write(addr, e))
+
+		msg := recv(t, srvMsgs)
+		assert.Equal(t, msg.addr, clientAddr)
+		assert.DeepEqual(t, msg.e, event.Event(e))
+	})
+
+	t.Run("write to unknown address fails", func(t *testing.T) {
+		assert.Assert(t, srv.Write("127.0.0.1:1", event.Ack{}) != nil)
+	})
+
+	t.Run("both ends disconnected on stop", func(t *testing.T) {
+		client.Stop()
+
+		assert.Equal(t, recv(t, clientDisconnected), addr)
+		assert.Equal(t, recv(t, srvDisconnected), clientAddr)
+		assert.NilError(t, recv(t, dialed))
+	})
+}